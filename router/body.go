@@ -0,0 +1,104 @@
+package router
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// maxDrainBytes is how much of an unread body Close is willing to discard to keep the connection reusable.
+const maxDrainBytes = 256 << 10
+
+var (
+	// ErrBodyClosed is returned when reading a body after it was closed.
+	ErrBodyClosed = errors.New("read on closed request body")
+	// ErrBodyNotDrained is returned by Close when too much of the body was left unread to discard it.
+	ErrBodyNotDrained = errors.New("request body too large to drain")
+)
+
+// body streams a request body straight off the connection. Read errors stick, so a body that failed
+// halfway keeps failing and Close tells the server the connection can't be reused.
+type body struct {
+	reader    io.Reader
+	remaining int64 // bytes left for Content-Length bodies, -1 for chunked ones
+	err       error
+	closed    bool
+	onEOF     func() // called once the body has been read to the end
+}
+
+func newBody(reader *bufio.Reader, contentLength int64) *body {
+	return &body{
+		reader:    io.LimitReader(reader, contentLength),
+		remaining: contentLength,
+	}
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyClosed
+	}
+
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n, err := b.reader.Read(p)
+	if b.remaining >= 0 {
+		b.remaining -= int64(n)
+	}
+	if errors.Is(err, io.EOF) && b.remaining > 0 { // connection ended before Content-Length was reached
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		b.err = err
+	}
+
+	if errors.Is(err, io.EOF) {
+		b.reachedEOF()
+	}
+
+	return n, err
+}
+
+func (b *body) reachedEOF() {
+	if b.onEOF != nil {
+		onEOF := b.onEOF
+		b.onEOF = nil
+		onEOF()
+	}
+}
+
+// Close discards whatever is left of the body so the next request on the connection can be read.
+func (b *body) Close() error {
+	if b.closed {
+		return b.err
+	}
+
+	if b.err == nil {
+		n, err := io.Copy(io.Discard, io.LimitReader(b, maxDrainBytes+1))
+		switch {
+		case err != nil:
+			b.err = err
+		case n > maxDrainBytes:
+			b.err = ErrBodyNotDrained
+		}
+	}
+	b.closed = true
+
+	return b.err
+}
+
+// bufferedBody is handed out by BodyReader once Body has read the stream into memory.
+type bufferedBody struct {
+	io.Reader
+	stream *body
+}
+
+func (b *bufferedBody) Close() error {
+	if b.stream == nil {
+		return nil
+	}
+
+	return b.stream.Close()
+}
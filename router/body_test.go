@@ -0,0 +1,117 @@
+package router
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBody_Read(t *testing.T) {
+	tests := []struct {
+		name          string
+		stream        string
+		contentLength int64
+		expectedBody  string
+		expectedErr   error
+	}{
+		{
+			name:          "reads up to the content length",
+			stream:        "Hello WorldGET / HTTP/1.1",
+			contentLength: 11,
+			expectedBody:  "Hello World",
+		},
+		{
+			name:          "empty body",
+			stream:        "GET / HTTP/1.1",
+			contentLength: 0,
+			expectedBody:  "",
+		},
+		{
+			name:          "stream ends before the content length",
+			stream:        "Hello",
+			contentLength: 11,
+			expectedBody:  "Hello",
+			expectedErr:   io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBody(bufio.NewReader(strings.NewReader(tt.stream)), tt.contentLength)
+			data, err := io.ReadAll(b)
+
+			if string(data) != tt.expectedBody {
+				t.Errorf("expected body %q but got %q", tt.expectedBody, data)
+			}
+
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected error %v but got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestBody_Close(t *testing.T) {
+	t.Run("discards the rest of the body", func(t *testing.T) {
+		reader := bufio.NewReader(strings.NewReader("Hello WorldGET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+		b := newBody(reader, 11)
+		b.Read(make([]byte, 3))
+
+		if err := b.Close(); err != nil {
+			t.Fatalf("failed closing body: %s", err)
+		}
+
+		if _, err := b.Read(make([]byte, 1)); !errors.Is(err, ErrBodyClosed) {
+			t.Errorf("expected ErrBodyClosed but got %v", err)
+		}
+
+		if _, err := Parse(reader); err != nil {
+			t.Errorf("expected the next request to parse after closing the body: %s", err)
+		}
+	})
+
+	t.Run("refuses to drain large bodies", func(t *testing.T) {
+		stream := strings.Repeat("a", maxDrainBytes+10)
+		b := newBody(bufio.NewReader(strings.NewReader(stream)), int64(len(stream)))
+
+		if err := b.Close(); !errors.Is(err, ErrBodyNotDrained) {
+			t.Errorf("expected ErrBodyNotDrained but got %v", err)
+		}
+	})
+
+	t.Run("keeps failing after a truncated body", func(t *testing.T) {
+		b := newBody(bufio.NewReader(strings.NewReader("Hello")), 11)
+		io.ReadAll(b)
+
+		if err := b.Close(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("expected io.ErrUnexpectedEOF but got %v", err)
+		}
+	})
+}
+
+func Test_httpRequest_Body(t *testing.T) {
+	request, err := Parse(bufio.NewReader(strings.NewReader("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 11\r\n\r\nHello World")))
+	if err != nil {
+		t.Fatalf("failed parsing request: %s", err)
+	}
+
+	chunk := make([]byte, 6)
+	if _, err := io.ReadFull(request.BodyReader(), chunk); err != nil {
+		t.Fatalf("failed reading body: %s", err)
+	}
+
+	if request.Body() != "World" {
+		t.Errorf("expected Body to buffer the unread rest but got %q", request.Body())
+	}
+
+	data, _ := io.ReadAll(request.BodyReader())
+	if string(data) != "World" {
+		t.Errorf("expected BodyReader to replay the buffered body but got %q", data)
+	}
+
+	if err := request.BodyReader().Close(); err != nil {
+		t.Errorf("failed closing body: %s", err)
+	}
+}
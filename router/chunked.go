@@ -0,0 +1,165 @@
+package router
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxChunkLineBytes caps a chunk size line, extensions included.
+	maxChunkLineBytes = 4096
+	// maxTrailerBytes caps the trailer section following the last chunk.
+	maxTrailerBytes = 64 << 10
+)
+
+// ErrMalformedChunk is returned when a chunked body doesn't follow the chunked transfer coding.
+var ErrMalformedChunk = errors.New("malformed chunked encoding")
+
+// chunkedReader decodes a Transfer-Encoding: chunked body. Chunk extensions are ignored and trailer
+// fields are stored in trailers once the last chunk is read.
+type chunkedReader struct {
+	reader    *bufio.Reader
+	remaining uint64 // bytes left in the current chunk
+	needCRLF  bool   // the current chunk's data is read but not the CRLF ending it
+	trailers  Headers
+	err       error
+}
+
+func newChunkedBody(reader *bufio.Reader, trailers Headers) *body {
+	return &body{
+		reader: &chunkedReader{
+			reader:   reader,
+			trailers: trailers,
+		},
+		remaining: -1,
+	}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	for c.remaining == 0 {
+		if c.needCRLF {
+			if c.err = c.readCRLF(); c.err != nil {
+				return 0, c.err
+			}
+			c.needCRLF = false
+		}
+
+		size, err := c.readChunkSize()
+		if err != nil {
+			c.err = err
+			return 0, err
+		}
+
+		if size == 0 { // last chunk, only trailers follow
+			if c.err = c.readTrailers(); c.err == nil {
+				c.err = io.EOF
+			}
+			return 0, c.err
+		}
+
+		c.remaining = size
+		c.needCRLF = true
+	}
+
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+
+	n, err := c.reader.Read(p)
+	c.remaining -= uint64(n)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	c.err = err
+
+	return n, err
+}
+
+func (c *chunkedReader) readChunkSize() (uint64, error) {
+	line, err := c.readLine(maxChunkLineBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	// Extensions follow the size after a ;
+	size, _, _ := strings.Cut(line, ";")
+	size = strings.TrimSpace(size)
+	if size == "" || len(size) > 16 {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedChunk, size)
+	}
+
+	length, err := strconv.ParseUint(size, 16, 63)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedChunk, size)
+	}
+
+	return length, nil
+}
+
+func (c *chunkedReader) readCRLF() error {
+	line, err := c.readLine(2)
+	if err != nil {
+		return err
+	}
+
+	if line != "" {
+		return fmt.Errorf("%w: chunk data longer than its size", ErrMalformedChunk)
+	}
+
+	return nil
+}
+
+func (c *chunkedReader) readTrailers() error {
+	remaining := maxTrailerBytes
+	for {
+		line, err := c.readLine(remaining)
+		if err != nil {
+			return err
+		}
+		remaining -= len(line) + 2
+
+		if line == "" {
+			return nil
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return fmt.Errorf("%w: malformed trailer %q", ErrMalformedChunk, line)
+		}
+
+		if c.trailers != nil {
+			c.trailers.Add(HeaderType(strings.TrimSpace(key)), strings.TrimSpace(value))
+		}
+	}
+}
+
+// readLine reads a CRLF terminated line of at most limit bytes, excluding the CRLF.
+func (c *chunkedReader) readLine(limit int) (string, error) {
+	remaining := limit + 2
+	line, err := readLine(c.reader, &remaining)
+	if errors.Is(err, io.EOF) {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	if errors.Is(err, ErrHeaderTooLarge) {
+		return "", fmt.Errorf("%w: line too long", ErrMalformedChunk)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", fmt.Errorf("%w: line not terminated by CRLF", ErrMalformedChunk)
+	}
+
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
@@ -0,0 +1,183 @@
+package router
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestChunkedReader(t *testing.T) {
+	tests := []struct {
+		name             string
+		stream           string
+		expectedBody     string
+		expectedTrailers map[string]string
+		expectedErr      error
+	}{
+		{
+			name:         "single chunk",
+			stream:       "b\r\nHello World\r\n0\r\n\r\n",
+			expectedBody: "Hello World",
+		},
+		{
+			name:         "multiple chunks",
+			stream:       "5\r\nHello\r\n1\r\n \r\n5\r\nWorld\r\n0\r\n\r\n",
+			expectedBody: "Hello World",
+		},
+		{
+			name:         "uppercase hex size",
+			stream:       "A\r\n0123456789\r\n0\r\n\r\n",
+			expectedBody: "0123456789",
+		},
+		{
+			name:         "chunk extensions are ignored",
+			stream:       "5;name=value\r\nHello\r\n6 ; other\r\n World\r\n0;last\r\n\r\n",
+			expectedBody: "Hello World",
+		},
+		{
+			name:         "empty body",
+			stream:       "0\r\n\r\n",
+			expectedBody: "",
+		},
+		{
+			name:             "trailers",
+			stream:           "5\r\nHello\r\n0\r\nChecksum: ABC123\r\nExpires: never\r\n\r\n",
+			expectedBody:     "Hello",
+			expectedTrailers: map[string]string{"checksum": "ABC123", "expires": "never"},
+		},
+		{
+			name:        "non hex chunk size",
+			stream:      "xyz\r\nHello\r\n0\r\n\r\n",
+			expectedErr: ErrMalformedChunk,
+		},
+		{
+			name:        "negative chunk size",
+			stream:      "-5\r\nHello\r\n0\r\n\r\n",
+			expectedErr: ErrMalformedChunk,
+		},
+		{
+			name:        "empty chunk size",
+			stream:      "\r\nHello\r\n0\r\n\r\n",
+			expectedErr: ErrMalformedChunk,
+		},
+		{
+			name:        "overflowing chunk size",
+			stream:      "fffffffffffffffff\r\nHello\r\n0\r\n\r\n",
+			expectedErr: ErrMalformedChunk,
+		},
+		{
+			name:         "chunk longer than its size",
+			stream:       "3\r\nHello\r\n0\r\n\r\n",
+			expectedBody: "Hel",
+			expectedErr:  ErrMalformedChunk,
+		},
+		{
+			name:        "size line without CRLF",
+			stream:      "5\nHello\r\n0\r\n\r\n",
+			expectedErr: ErrMalformedChunk,
+		},
+		{
+			name:        "malformed trailer",
+			stream:      "0\r\nnot a trailer\r\n\r\n",
+			expectedErr: ErrMalformedChunk,
+		},
+		{
+			name:         "truncated in chunk data",
+			stream:       "b\r\nHello",
+			expectedBody: "Hello",
+			expectedErr:  io.ErrUnexpectedEOF,
+		},
+		{
+			name:         "truncated before the last chunk",
+			stream:       "5\r\nHello\r\n",
+			expectedBody: "Hello",
+			expectedErr:  io.ErrUnexpectedEOF,
+		},
+		{
+			name:         "truncated in trailers",
+			stream:       "5\r\nHello\r\n0\r\nChecksum: abc\r\n",
+			expectedBody: "Hello",
+			expectedErr:  io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trailers := Headers{}
+			b := newChunkedBody(bufio.NewReader(strings.NewReader(tt.stream)), trailers)
+			data, err := io.ReadAll(b)
+
+			if string(data) != tt.expectedBody {
+				t.Errorf("expected body %q but got %q", tt.expectedBody, data)
+			}
+
+			if tt.expectedErr == nil && err != nil {
+				t.Errorf("failed reading chunked body: %s", err)
+			}
+
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected error %v but got %v", tt.expectedErr, err)
+			}
+
+			for key, value := range tt.expectedTrailers {
+				if trailers.Get(HeaderType(key)) != value {
+					t.Errorf("expected trailer %s to be %q but got %q", key, value, trailers.Get(HeaderType(key)))
+				}
+			}
+		})
+	}
+}
+
+func TestParse_TransferEncoding(t *testing.T) {
+	requests := []struct {
+		request      string
+		expectedBody string
+		expectedErr  error
+		shouldFail   bool
+	}{
+		{
+			request:      "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nHello\r\n0\r\n\r\n",
+			expectedBody: "Hello",
+		},
+		{
+			request:      "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: Chunked\r\n\r\n5\r\nHello\r\n0\r\n\r\n",
+			expectedBody: "Hello",
+		},
+		{
+			request:    "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\n5\r\nHello\r\n0\r\n\r\n",
+			shouldFail: true,
+		},
+		{
+			request:     "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: gzip, chunked\r\n\r\n",
+			shouldFail:  true,
+			expectedErr: ErrUnsupportedTransferEncoding,
+		},
+	}
+
+	for _, tt := range requests {
+		reader := bufio.NewReader(strings.NewReader(tt.request))
+		httpReq, err := Parse(reader)
+
+		if tt.shouldFail {
+			if err == nil {
+				t.Errorf("expected parser to fail on: %s", tt.request)
+			}
+
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected %v but got %v", tt.expectedErr, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("failed parsing request: %s", err)
+			continue
+		}
+
+		if httpReq.Body() != tt.expectedBody {
+			t.Errorf("expected body to equal %s but got %s", tt.expectedBody, httpReq.Body())
+		}
+	}
+}
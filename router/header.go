@@ -1,5 +1,12 @@
 package router
 
+import (
+	"iter"
+	"maps"
+	"net/textproto"
+	"slices"
+)
+
 type HeaderType string
 
 const (
@@ -35,9 +42,17 @@ const (
 	AcceptEncoding  HeaderType = "Accept-Encoding"
 
 	// Connection
+	ConnectionHeader HeaderType = "Connection"
 	KeepAlive        HeaderType = "Keep-Alive"
 	TransferEncoding HeaderType = "Transfer-Encoding"
 
+	// Proxies
+	Forwarded       HeaderType = "Forwarded"
+	XForwardedFor   HeaderType = "X-Forwarded-For"
+	XForwardedProto HeaderType = "X-Forwarded-Proto"
+	XForwardedHost  HeaderType = "X-Forwarded-Host"
+	XRealIP         HeaderType = "X-Real-IP"
+
 	// Security
 	StrictTransportSecurity HeaderType = "Strict-Transport-Security"
 	XContentTypeOptions     HeaderType = "X-Content-Type-Options"
@@ -56,28 +71,74 @@ const (
 	RetryAfter HeaderType = "Retry-After"
 )
 
-type Header interface {
-	Add(header HeaderType, value interface{})
-	Get() map[HeaderType]string
+// Headers holds header fields keyed by their canonical name, e.g. "content-type" is stored as "Content-Type".
+// A field can repeat, its values are kept verbatim in the order they were added.
+type Headers map[string][]string
+
+// Get returns the first value of key, or "" when it isn't set.
+func (h Headers) Get(key HeaderType) string {
+	values := h[canonicalKey(key)]
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// Values returns every value of key.
+func (h Headers) Values(key HeaderType) []string {
+	return h[canonicalKey(key)]
+}
+
+// Has reports whether key is set, even if only to an empty value.
+func (h Headers) Has(key HeaderType) bool {
+	_, exists := h[canonicalKey(key)]
+	return exists
+}
+
+// Set replaces all values of key with value.
+func (h Headers) Set(key HeaderType, value string) {
+	h[canonicalKey(key)] = []string{value}
+}
+
+// Add appends value to the values of key.
+func (h Headers) Add(key HeaderType, value string) {
+	name := canonicalKey(key)
+	h[name] = append(h[name], value)
 }
 
-type header struct {
-	writer HTTPWriter
-	value  map[HeaderType]string
+// Del removes every value of key.
+func (h Headers) Del(key HeaderType) {
+	delete(h, canonicalKey(key))
 }
 
-func (h *httpWriter) Header() Header {
-	return &header{
-		writer: h,
-		value:  make(map[HeaderType]string, 1),
+// Clone returns a deep copy, changes to it don't affect h.
+func (h Headers) Clone() Headers {
+	if h == nil {
+		return nil
 	}
+
+	clone := make(Headers, len(h))
+	for name, values := range h {
+		clone[name] = slices.Clone(values)
+	}
+
+	return clone
 }
 
-func (h *header) Add(headerType HeaderType, value interface{}) {
-	h.value[headerType] = value.(string)
-	h.writer.addHeader(h)
+// All iterates over every name and value pair, sorted by name so output built from it is stable.
+func (h Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, name := range slices.Sorted(maps.Keys(h)) {
+			for _, value := range h[name] {
+				if !yield(name, value) {
+					return
+				}
+			}
+		}
+	}
 }
 
-func (h *header) Get() map[HeaderType]string {
-	return h.value
+func canonicalKey(key HeaderType) string {
+	return textproto.CanonicalMIMEHeaderKey(string(key))
 }
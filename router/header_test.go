@@ -0,0 +1,80 @@
+package router
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	t.Run("keys are case insensitive", func(t *testing.T) {
+		headers := Headers{}
+		headers.Set("content-type", "Text/Plain")
+
+		if headers.Get(ContentType) != "Text/Plain" {
+			t.Errorf("expected %q but got %q", "Text/Plain", headers.Get(ContentType))
+		}
+
+		if _, exists := headers["Content-Type"]; !exists {
+			t.Errorf("expected key to be stored canonically but got %v", headers)
+		}
+	})
+
+	t.Run("add keeps every value", func(t *testing.T) {
+		headers := Headers{}
+		headers.Add(SetCookie, "a=1")
+		headers.Add("set-cookie", "b=2")
+
+		if !slices.Equal(headers.Values(SetCookie), []string{"a=1", "b=2"}) {
+			t.Errorf("expected both values but got %v", headers.Values(SetCookie))
+		}
+
+		if headers.Get(SetCookie) != "a=1" {
+			t.Errorf("expected first value but got %q", headers.Get(SetCookie))
+		}
+	})
+
+	t.Run("set replaces and del removes", func(t *testing.T) {
+		headers := Headers{}
+		headers.Add(Allow, "GET")
+		headers.Add(Allow, "POST")
+		headers.Set(Allow, "PUT")
+
+		if !slices.Equal(headers.Values(Allow), []string{"PUT"}) {
+			t.Errorf("expected values to be replaced but got %v", headers.Values(Allow))
+		}
+
+		headers.Del("allow")
+		if headers.Has(Allow) || headers.Get(Allow) != "" {
+			t.Errorf("expected header to be removed but got %v", headers)
+		}
+	})
+
+	t.Run("clone is independent", func(t *testing.T) {
+		headers := Headers{}
+		headers.Add(CacheControl, "no-cache")
+		clone := headers.Clone()
+		clone.Add(CacheControl, "no-store")
+		clone.Set(ContentType, "text/html")
+
+		if len(headers.Values(CacheControl)) != 1 || headers.Has(ContentType) {
+			t.Errorf("expected original to be untouched but got %v", headers)
+		}
+	})
+
+	t.Run("all is sorted by name", func(t *testing.T) {
+		headers := Headers{}
+		headers.Add(SetCookie, "a=1")
+		headers.Add(ContentType, "text/plain")
+		headers.Add(SetCookie, "b=2")
+
+		var pairs []string
+		for name, value := range headers.All() {
+			pairs = append(pairs, name+": "+value)
+		}
+
+		expected := []string{"Content-Type: text/plain", "Set-Cookie: a=1", "Set-Cookie: b=2"}
+		if !slices.Equal(pairs, expected) {
+			t.Errorf("expected %v but got %v", expected, pairs)
+		}
+	})
+}
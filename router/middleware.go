@@ -1,5 +1,7 @@
 package router
 
+import "slices"
+
 type MiddlewareFunc func(writer HTTPWriter, request HTTPRequest, next func())
 
 func ApplyMiddlewares(
@@ -24,14 +26,14 @@ func middlewareWrapper(w HTTPWriter, r HTTPRequest, next func(), middleware Midd
 	}
 }
 
+// GetMiddlewares returns the middlewares a route runs through, those of its outermost scope first. The slice
+// is always a fresh one, requests on other connections build theirs from the same scopes at the same time.
 func GetMiddlewares(node *node) []MiddlewareFunc {
-	middlewares := node.middlewares
-
-	if node.parent != nil {
-		middlewares = append(GetMiddlewares(node.parent), middlewares...)
+	if node.parent == nil {
+		return slices.Clone(node.middlewares)
 	}
 
-	return middlewares
+	return slices.Concat(GetMiddlewares(node.parent), node.middlewares)
 }
 
 func (r *router) Use(middlewareFunc func(writer HTTPWriter, request HTTPRequest, next func())) {
@@ -170,10 +170,40 @@ type mockWriter struct{}
 
 func (h *mockWriter) Response(payload string, statusCode int) {}
 
-func (h *mockWriter) Header() Header {
-	return &header{}
+func (h *mockWriter) WriteHeader(statusCode int) {}
+
+func (h *mockWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (h *mockWriter) Flush() error {
+	return nil
+}
+
+func (h *mockWriter) Finish() error {
+	return nil
+}
+
+func (h *mockWriter) Header() Headers {
+	return Headers{}
 }
-func (h *mockWriter) addHeader(header Header) {}
+func (h *mockWriter) SetKeepAlive(keepAlive bool) {}
+
+func (h *mockWriter) SetProto(proto string) {}
+
+func (h *mockWriter) KeepAlive() bool {
+	return true
+}
+
+func (h *mockWriter) Written() bool {
+	return false
+}
+
+func (h *mockWriter) HeaderSent() bool {
+	return false
+}
+
+func (h *mockWriter) Reset() {}
 
 func TestGetMiddlewares(t *testing.T) {
 	mw1 := func(writer HTTPWriter, request HTTPRequest, next func()) {}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RouteBuilder configures a route after it was registered, e.g. r.Get("/users/:id", show).Name("user.show").
+type RouteBuilder interface {
+	// Name makes the route available to Router.URL, names are unique across a router and its groups.
+	Name(name string) RouteBuilder
+}
+
+type routeBuilder struct {
+	router *router
+	routes []*route
+}
+
+func (b *routeBuilder) Name(name string) RouteBuilder {
+	if len(b.routes) == 0 {
+		return b
+	}
+
+	if existing, exists := b.router.registry.names[name]; exists {
+		b.router.fail(fmt.Errorf("failed naming route %s %s, %s is already the name of %s %s", b.routes[0].Method, b.routes[0].Url, name, existing.Method, existing.Url))
+		return b
+	}
+
+	for _, route := range b.routes {
+		route.Name = name
+	}
+	b.router.registry.names[name] = b.routes[0]
+
+	return b
+}
+
+// URL builds the path of the route called name, group prefixes included. Params are given as name and
+// value pairs, e.g. URL("user.post", "id", "42", "slug", "hello-world"), and are escaped. Every param
+// of the route needs a value that fits its constraint, and params the route doesn't have are an error.
+func (r *router) URL(name string, params ...string) (string, error) {
+	route, exists := r.registry.names[name]
+	if !exists {
+		return "", fmt.Errorf("no route named %s", name)
+	}
+
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("params for route %s must come in name and value pairs, got %d values", name, len(params))
+	}
+
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	var path strings.Builder
+	i := 0
+	for j, segment := range splitSegments(route.Url) {
+		if j > 0 {
+			path.WriteString("/")
+		}
+
+		if !isDynamic(segment) {
+			path.WriteString(segment)
+			continue
+		}
+
+		param := route.params[i]
+		i++
+		value, exists := values[param.name]
+		if !exists {
+			return "", fmt.Errorf("missing param %s for route %s", param.name, name)
+		}
+		delete(values, param.name)
+
+		if param.constraint != nil && !param.constraint.MatchString(value) {
+			return "", fmt.Errorf("param %s for route %s doesn't match %s: %q", param.name, name, param.expr, value)
+		}
+
+		if param.wildcard {
+			var escaped []string
+			for _, part := range strings.Split(value, "/") {
+				escaped = append(escaped, url.PathEscape(part))
+			}
+			path.WriteString(strings.Join(escaped, "/"))
+			continue
+		}
+
+		if value == "" {
+			return "", fmt.Errorf("param %s for route %s must not be empty", param.name, name)
+		}
+		path.WriteString(url.PathEscape(value))
+	}
+
+	for unknown := range values {
+		return "", fmt.Errorf("route %s has no param %s", name, unknown)
+	}
+
+	return path.String(), nil
+}
@@ -0,0 +1,107 @@
+package router
+
+import "testing"
+
+func Test_router_URL(t *testing.T) {
+	r := NewRouter()
+	handler := func(writer HTTPWriter, request HTTPRequest) {}
+	r.Get("/users/:id<int>", handler).Name("user.show")
+	r.Get("/about", handler).Name("about")
+	r.Get("/static/*filepath", handler).Name("static")
+	r.Any("/echo/:message", handler).Name("echo")
+	r.Group("/api", func(api Router) {
+		api.Group("/teams/:team", func(teams Router) {
+			teams.Post("/members/{member:[a-z]+}", handler).Name("team.member")
+		})
+	})
+
+	tests := []struct {
+		name        string
+		route       string
+		params      []string
+		expectedURL string
+		expectErr   bool
+	}{
+		{name: "static route", route: "about", expectedURL: "/about"},
+		{name: "param", route: "user.show", params: []string{"id", "42"}, expectedURL: "/users/42"},
+		{name: "group prefixes", route: "team.member", params: []string{"team", "core", "member", "ana"}, expectedURL: "/api/teams/core/members/ana"},
+		{name: "escaped value", route: "echo", params: []string{"message", "hello world/again"}, expectedURL: "/echo/hello%20world%2Fagain"},
+		{name: "wildcard keeps slashes", route: "static", params: []string{"filepath", "css/site one.css"}, expectedURL: "/static/css/site%20one.css"},
+		{name: "unknown route", route: "user.delete", params: []string{"id", "42"}, expectErr: true},
+		{name: "missing param", route: "user.show", expectErr: true},
+		{name: "constraint violated", route: "user.show", params: []string{"id", "me"}, expectErr: true},
+		{name: "empty param", route: "echo", params: []string{"message", ""}, expectErr: true},
+		{name: "unknown param", route: "about", params: []string{"id", "42"}, expectErr: true},
+		{name: "odd params", route: "user.show", params: []string{"id"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, err := r.URL(tt.route, tt.params...)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("expected an error but got %s", url)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed building url: %s", err)
+			}
+
+			if url != tt.expectedURL {
+				t.Errorf("expected %s but got %s", tt.expectedURL, url)
+			}
+		})
+	}
+
+	t.Run("generated urls match their route", func(t *testing.T) {
+		url, _ := r.URL("team.member", "team", "core", "member", "ana")
+		n, err := r.FindMatchingRoute(&httpRequest{url: url, method: Post})
+		if err != nil || n.Route.Name != "team.member" {
+			t.Errorf("expected %s to match team.member but got %v", url, err)
+		}
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		assertPanic(t, func() { r.Get("/other", handler).Name("about") })
+	})
+}
+
+func Test_router_URLRoundTrip(t *testing.T) {
+	r := NewRouter()
+	handler := func(writer HTTPWriter, request HTTPRequest) {}
+	r.Get("/users/:name", handler).Name("user")
+	r.Get("/files/*path", handler).Name("file")
+	r.Get("/tags/{tag:[a-z ]+}", handler).Name("tag")
+
+	tests := []struct {
+		route string
+		param string
+		value string
+	}{
+		{route: "user", param: "name", value: "john doe"},
+		{route: "user", param: "name", value: "a/b?c#d%e"},
+		{route: "user", param: "name", value: "zoë"},
+		{route: "file", param: "path", value: "docs/read me.md"},
+		{route: "tag", param: "tag", value: "go lang"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			url, err := r.URL(tt.route, tt.param, tt.value)
+			if err != nil {
+				t.Fatalf("failed building url: %s", err)
+			}
+
+			request := &httpRequest{url: url, method: Get}
+			if _, err := r.FindMatchingRoute(request); err != nil {
+				t.Fatalf("expected %s to match but got %s", url, err)
+			}
+
+			if value, _ := request.GetURLParam(tt.param); value != tt.value {
+				t.Errorf("expected %s to round-trip through %s but got %q", tt.value, url, value)
+			}
+		})
+	}
+}
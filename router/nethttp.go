@@ -0,0 +1,327 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+)
+
+// ToHTTPHandler serves r as a net/http handler, to run it under http.Server, httptest.Server or net/http
+// middleware. Routers are http.Handlers themselves, this is for when the conversion should read explicitly.
+func ToHTTPHandler(r Router) http.Handler {
+	return routerHandler{router: r}
+}
+
+type routerHandler struct {
+	router Router
+}
+
+func (h routerHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	request := newRequestFromHTTP(req)
+	node, err := h.router.FindMatchingRoute(request)
+	if err != nil {
+		node = h.router.FindFallbackRoute(request)
+	}
+	request.SetRouterURL(node.Route.Url)
+
+	writer := &netWriter{w: w}
+	ApplyMiddlewares(writer, request, GetMiddlewares(node), node.Route.Handler)()
+	writer.Finish()
+}
+
+// ServeHTTP makes routers usable anywhere net/http expects a handler, see ToHTTPHandler.
+func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ToHTTPHandler(r).ServeHTTP(w, req)
+}
+
+// FromHTTPHandler turns a net/http handler, e.g. pprof or promhttp, into a route handler. It sees the request
+// as it came in, headers, body, context and trailers included, and its response goes out through writer.
+func FromHTTPHandler(handler http.Handler) func(writer HTTPWriter, request HTTPRequest) {
+	return func(writer HTTPWriter, request HTTPRequest) {
+		req, err := toHTTPRequest(request)
+		if err != nil {
+			writer.Response("Bad Request", 400)
+			return
+		}
+
+		handler.ServeHTTP(&responseWriter{writer: writer}, req)
+	}
+}
+
+// newRequestFromHTTP builds the request a router sees from one net/http parsed.
+func newRequestFromHTTP(req *http.Request) *httpRequest {
+	headers := Headers(req.Header.Clone())
+	if headers == nil {
+		headers = Headers{}
+	}
+	headers.Set(Host, req.Host) // net/http moves it out of the header map
+
+	requestURI := req.RequestURI
+	if requestURI == "" {
+		requestURI = req.URL.RequestURI()
+	}
+
+	params := make(map[string]string)
+	for key, values := range req.URL.Query() {
+		params[key] = values[len(values)-1]
+	}
+
+	request := &httpRequest{
+		startLine:  fmt.Sprintf("%s %s %s", req.Method, requestURI, req.Proto),
+		headers:    headers,
+		trailers:   Headers(req.Trailer), // net/http fills in the values once the body is read
+		params:     params,
+		url:        req.URL.EscapedPath(),
+		requestURI: requestURI,
+		method:     Request(req.Method),
+		proto:      req.Proto,
+		tls:        req.TLS,
+		ctx:        req.Context(),
+		values:     &values{},
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		request.stream = &body{reader: req.Body, remaining: -1}
+	}
+
+	if addrPort, err := netip.ParseAddrPort(req.RemoteAddr); err == nil {
+		request.remote = net.TCPAddrFromAddrPort(addrPort)
+	}
+
+	if local, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		request.local = local
+	}
+
+	return request
+}
+
+// toHTTPRequest builds the *http.Request a net/http handler expects from request.
+func toHTTPRequest(request HTTPRequest) (*http.Request, error) {
+	target := request.RequestURI()
+	if target == "" { // put together by hand rather than parsed
+		target = request.Url()
+		if query := encodeParams(request.Params()); query != "" {
+			target += "?" + query
+		}
+	}
+
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing request target %s: %w", target, err)
+	}
+
+	proto := request.Proto()
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok {
+		return nil, fmt.Errorf("failed parsing HTTP version %s", proto)
+	}
+
+	header := http.Header(request.Headers().Clone())
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Del(string(Host))
+
+	req := &http.Request{
+		Method:     string(request.Method()),
+		URL:        u,
+		Proto:      proto,
+		ProtoMajor: major,
+		ProtoMinor: minor,
+		Header:     header,
+		Body:       http.NoBody,
+		Host:       request.Host(),
+		RequestURI: target,
+		TLS:        request.TLS(),
+		Trailer:    http.Header(request.Trailers()),
+	}
+
+	switch {
+	case request.Headers().Has(TransferEncoding):
+		req.TransferEncoding = []string{"chunked"}
+		req.ContentLength = -1
+		req.Body = request.BodyReader()
+		header.Del(string(TransferEncoding))
+	case request.Headers().Has(ContentLength):
+		req.ContentLength, err = strconv.ParseInt(request.Headers().Get(ContentLength), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing Content-Length: %w", err)
+		}
+		if req.ContentLength > 0 {
+			req.Body = request.BodyReader()
+		}
+	}
+
+	if addr := request.RemoteAddr(); addr != nil {
+		req.RemoteAddr = addr.String()
+	}
+
+	ctx := request.Context()
+	if addr := request.LocalAddr(); addr != nil {
+		ctx = context.WithValue(ctx, http.LocalAddrContextKey, addr)
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+func encodeParams(params map[string]string) string {
+	query := url.Values{}
+	for key, value := range params {
+		query.Set(key, value)
+	}
+
+	return query.Encode()
+}
+
+// netWriter is an HTTPWriter on top of a net/http response. Like httpWriter it holds the headers back
+// until the body starts, so handlers can still change them after WriteHeader.
+type netWriter struct {
+	w          http.ResponseWriter
+	status     int
+	headerSent bool
+	finished   bool
+}
+
+func (n *netWriter) Response(payload string, statusCode int) {
+	if n.status != 0 {
+		return
+	}
+
+	if len(payload) > 0 && !n.Header().Has(ContentLength) {
+		n.Header().Set(ContentLength, strconv.Itoa(len(payload)))
+	}
+	n.WriteHeader(statusCode)
+	n.Write([]byte(payload))
+	n.Finish()
+}
+
+func (n *netWriter) WriteHeader(statusCode int) {
+	if n.status != 0 {
+		return
+	}
+
+	n.status = statusCode
+}
+
+func (n *netWriter) Write(p []byte) (int, error) {
+	if n.finished {
+		return 0, ErrResponseFinished
+	}
+
+	n.sendHeader()
+	return n.w.Write(p)
+}
+
+func (n *netWriter) Flush() error {
+	if n.finished {
+		return nil
+	}
+
+	n.sendHeader()
+	return http.NewResponseController(n.w).Flush()
+}
+
+func (n *netWriter) Finish() error {
+	if n.finished || n.status == 0 {
+		return nil
+	}
+
+	n.sendHeader()
+	n.finished = true
+
+	return nil
+}
+
+func (n *netWriter) sendHeader() {
+	if n.status == 0 {
+		n.WriteHeader(200)
+	}
+
+	if !n.headerSent {
+		n.headerSent = true
+		n.w.WriteHeader(n.status)
+	}
+}
+
+// Header shares its map with the http.ResponseWriter, both keep keys in canonical form.
+func (n *netWriter) Header() Headers {
+	return Headers(n.w.Header())
+}
+
+// SetKeepAlive only matters for closing, net/http decides on keep-alive itself.
+func (n *netWriter) SetKeepAlive(keepAlive bool) {
+	if !keepAlive {
+		n.Header().Set(ConnectionHeader, "close")
+	}
+}
+
+// SetProto does nothing, net/http already knows which version the client spoke.
+func (n *netWriter) SetProto(proto string) {}
+
+func (n *netWriter) KeepAlive() bool {
+	for _, value := range n.Header().Values(ConnectionHeader) {
+		if hasToken(value, "close") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (n *netWriter) Written() bool {
+	return n.status != 0
+}
+
+func (n *netWriter) HeaderSent() bool {
+	return n.headerSent
+}
+
+// Reset clears the headers shared with the http.ResponseWriter along with the status.
+func (n *netWriter) Reset() {
+	if n.headerSent {
+		return
+	}
+
+	n.status = 0
+	clear(n.w.Header())
+}
+
+// responseWriter is an http.ResponseWriter on top of an HTTPWriter, for net/http handlers mounted on a router.
+type responseWriter struct {
+	writer HTTPWriter
+}
+
+// Header shares its map with the HTTPWriter, both keep keys in canonical form.
+func (r *responseWriter) Header() http.Header {
+	return http.Header(r.writer.Header())
+}
+
+func (r *responseWriter) Write(p []byte) (int, error) {
+	return r.writer.Write(p)
+}
+
+// WriteHeader ignores 1xx codes, an HTTPWriter only sends the final status.
+func (r *responseWriter) WriteHeader(statusCode int) {
+	if statusCode >= 100 && statusCode < 200 {
+		return
+	}
+
+	r.writer.WriteHeader(statusCode)
+}
+
+// Flush makes the response an http.Flusher, so net/http handlers can stream.
+func (r *responseWriter) Flush() {
+	r.writer.Flush()
+}
+
+// FlushError is what http.ResponseController uses, it reports the error Flush can't.
+func (r *responseWriter) FlushError() error {
+	return r.writer.Flush()
+}
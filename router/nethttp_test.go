@@ -0,0 +1,246 @@
+package router
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestToHTTPHandler(t *testing.T) {
+	r := NewRouter()
+	r.Use(func(writer HTTPWriter, request HTTPRequest, next func()) {
+		writer.Header().Set("X-Middleware", "ran")
+		next()
+	})
+	r.Get("/users/:id", func(writer HTTPWriter, request HTTPRequest) {
+		id, _ := request.GetURLParam("id")
+		page, _ := request.GetQueryParam("page")
+		agent, _ := request.GetHeader("User-Agent")
+		writer.Header().Set(ContentType, "text/plain")
+		writer.Response(fmt.Sprintf("%s %s %s %s", id, page, agent, request.Host()), 200)
+	})
+	r.Post("/echo", func(writer HTTPWriter, request HTTPRequest) {
+		writer.WriteHeader(201)
+		writer.Header().Set("X-Late", "still sent") // headers wait for the body, like with the built-in writer
+		io.Copy(writer, request.BodyReader())
+	})
+	r.Get("/stream", func(writer HTTPWriter, request HTTPRequest) {
+		writer.Write([]byte("first\n"))
+		writer.Flush()
+		<-request.Context().Done()
+	})
+	server := httptest.NewServer(ToHTTPHandler(r))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           io.Reader
+		expectedStatus int
+		expectedBody   string
+		expectedHeader map[string]string
+	}{
+		{
+			name:           "params, query and headers",
+			method:         "GET",
+			path:           "/users/42?page=2",
+			expectedStatus: 200,
+			expectedBody:   "42 2 test-agent " + strings.TrimPrefix(server.URL, "http://"),
+			expectedHeader: map[string]string{"Content-Type": "text/plain", "X-Middleware": "ran", "Content-Length": "31"},
+		},
+		{
+			name:           "streamed request body",
+			method:         "POST",
+			path:           "/echo",
+			body:           io.MultiReader(strings.NewReader("Hello "), strings.NewReader("World")),
+			expectedStatus: 201,
+			expectedBody:   "Hello World",
+			expectedHeader: map[string]string{"X-Late": "still sent"},
+		},
+		{
+			name:           "not found",
+			method:         "GET",
+			path:           "/missing",
+			expectedStatus: 404,
+			expectedHeader: map[string]string{"X-Middleware": "ran"},
+		},
+		{
+			name:           "method not allowed",
+			method:         "DELETE",
+			path:           "/echo",
+			expectedStatus: 405,
+			expectedHeader: map[string]string{"Allow": "OPTIONS, POST"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, tt.body)
+			if err != nil {
+				t.Fatalf("failed building request: %s", err)
+			}
+			req.Header.Set("User-Agent", "test-agent")
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("failed sending request: %s", err)
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d but got %d", tt.expectedStatus, res.StatusCode)
+			}
+
+			if tt.expectedBody != "" && string(body) != tt.expectedBody {
+				t.Errorf("expected body %q but got %q", tt.expectedBody, body)
+			}
+
+			for key, value := range tt.expectedHeader {
+				if res.Header.Get(key) != value {
+					t.Errorf("expected header %s to be %q but got %q", key, value, res.Header.Get(key))
+				}
+			}
+		})
+	}
+
+	t.Run("streamed response", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/stream")
+		if err != nil {
+			t.Fatalf("failed sending request: %s", err)
+		}
+
+		// The handler is still running, only a flush gets the first line here
+		line, err := bufio.NewReader(res.Body).ReadString('\n')
+		if err != nil || line != "first\n" {
+			t.Errorf("expected the flushed line but got %q, %v", line, err)
+		}
+		res.Body.Close()
+	})
+}
+
+func TestFromHTTPHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Id", req.PathValue("id"))
+		w.WriteHeader(202)
+		fmt.Fprintf(w, "%s %s %s", req.URL.Path, req.URL.Query().Get("page"), req.Header.Get("X-Token"))
+	})
+	mux.HandleFunc("POST /upload", func(w http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		fmt.Fprintf(w, "%d %s %s", req.ContentLength, data, req.Host)
+	})
+	mux.HandleFunc("GET /stream", func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, "part")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "s")
+	})
+
+	r := NewRouter()
+	r.Group("/api", func(api Router) {
+		api.Mount("/legacy", mux)
+	})
+	r.Get("/direct", FromHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.Method+" "+req.RequestURI)
+	})))
+
+	tests := []struct {
+		name             string
+		request          string
+		expectedResponse string
+	}{
+		{
+			name:             "mounted with the prefix stripped",
+			request:          "GET /api/legacy/users/7?page=3 HTTP/1.1\r\nHost: example.com\r\nX-Token: abc\r\n\r\n",
+			expectedResponse: "HTTP/1.1 202 Accepted\r\nContent-Length: 14\r\nX-Id: 7\r\n\r\n/users/7 3 abc",
+		},
+		{
+			name:             "request body",
+			request:          "POST /api/legacy/upload HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nHello",
+			expectedResponse: "HTTP/1.1 200 OK\r\nContent-Length: 19\r\n\r\n5 Hello example.com",
+		},
+		{
+			name:             "flushed response",
+			request:          "GET /api/legacy/stream HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			expectedResponse: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n4\r\npart\r\n1\r\ns\r\n0\r\n\r\n",
+		},
+		{
+			name:             "unmatched path inside the mount",
+			request:          "GET /api/legacy/nothing HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			expectedResponse: "HTTP/1.1 404 Not Found\r\nContent-Length: 19\r\nContent-Type: text/plain; charset=utf-8\r\nX-Content-Type-Options: nosniff\r\n\r\n404 page not found\n",
+		},
+		{
+			name:             "single handler",
+			request:          "GET /direct?q=1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			expectedResponse: "HTTP/1.1 200 OK\r\nContent-Length: 15\r\n\r\nGET /direct?q=1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := Parse(bufio.NewReader(strings.NewReader(tt.request)))
+			if err != nil {
+				t.Fatalf("failed parsing request: %s", err)
+			}
+
+			n, err := r.FindMatchingRoute(request)
+			if err != nil {
+				t.Fatalf("expected a route to match but got %s", err)
+			}
+
+			conn := &mockConnection{}
+			writer := NewHTTPWriter(conn, request.Method())
+			n.Route.Handler(writer, request)
+			writer.Finish()
+
+			if string(conn.written) != tt.expectedResponse {
+				t.Errorf("expected response %q but got %q", tt.expectedResponse, conn.written)
+			}
+		})
+	}
+}
+
+func TestRouter_MountHTTPHandler(t *testing.T) {
+	t.Run("prefix itself and everything below", func(t *testing.T) {
+		r := NewRouter()
+		r.Mount("/debug", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			io.WriteString(w, req.URL.Path)
+		}))
+
+		for _, tt := range []struct{ path, expectedPath string }{
+			{path: "/debug", expectedPath: ""},
+			{path: "/debug/", expectedPath: "/"},
+			{path: "/debug/pprof/heap", expectedPath: "/pprof/heap"},
+		} {
+			request := &httpRequest{url: tt.path, method: Post, proto: "HTTP/1.1"}
+			n, err := r.FindMatchingRoute(request)
+			if err != nil {
+				t.Errorf("expected %s to reach the mounted handler but got %s", tt.path, err)
+				continue
+			}
+
+			conn := &mockConnection{}
+			writer := NewHTTPWriter(conn, Post)
+			n.Route.Handler(writer, request)
+			writer.Finish()
+			if !strings.HasSuffix(string(conn.written), "\r\n\r\n"+tt.expectedPath) {
+				t.Errorf("expected the handler to see %q but got %q", tt.expectedPath, conn.written)
+			}
+		}
+	})
+
+	t.Run("nil handler", func(t *testing.T) {
+		assertPanic(t, func() { NewRouter().Mount("/debug", nil) })
+	})
+
+	t.Run("under a param", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+		assertPanic(t, func() { NewRouter().Mount("/users/:id", handler) })
+		assertPanic(t, func() { NewRouter().Group("/users/:id").Mount("/files", handler) })
+	})
+}
@@ -4,53 +4,110 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
-	"io"
+	"log/slog"
+	"math"
 	"net/url"
 	"strconv"
 	"strings"
 )
 
+var (
+	// ErrHeaderTooLarge is returned when the start line and headers exceed ParseOptions.MaxHeaderBytes.
+	ErrHeaderTooLarge = errors.New("request header too large")
+	// ErrURITooLong is returned when the start line alone exceeds ParseOptions.MaxHeaderBytes.
+	ErrURITooLong = errors.New("request URI too long")
+	// ErrUnsupportedVersion is returned for well-formed HTTP versions other than HTTP/1.0 and HTTP/1.1.
+	ErrUnsupportedVersion = errors.New("unsupported HTTP version")
+	// ErrUnsupportedTransferEncoding is returned for transfer codings other than chunked.
+	ErrUnsupportedTransferEncoding = errors.New("unsupported transfer encoding")
+)
+
+// ParseOptions tunes how ParseWithOptions reads a request.
+type ParseOptions struct {
+	// MaxHeaderBytes caps the combined size of the start line and headers, zero means no limit.
+	MaxHeaderBytes int
+	// Logger receives diagnostics about requests that are accepted despite being slightly off, nil silences them.
+	Logger *slog.Logger
+	// OnBodyEOF is called once the request body has been read to the end, from then on nothing else reads
+	// the request off the connection. It's called right away for requests without a body.
+	OnBodyEOF func()
+}
+
 func Parse(reader *bufio.Reader) (HTTPRequest, error) {
-	var request httpRequest
+	return ParseWithOptions(reader, ParseOptions{})
+}
+
+func ParseWithOptions(reader *bufio.Reader, options ParseOptions) (HTTPRequest, error) {
+	request := httpRequest{values: &values{}}
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	remaining := options.MaxHeaderBytes
+	if remaining <= 0 {
+		remaining = math.MaxInt
+	}
 
 	// Handle startline
-	startLine, err := parseStartline(reader)
+	startLine, err := parseStartline(reader, &remaining)
 	if err != nil {
-		return &request, fmt.Errorf("failed parsing startline: %s", err)
+		return &request, fmt.Errorf("failed parsing startline: %w", err)
 	}
 
 	request.startLine = startLine
 	request.method = parseMethod(startLine)
 	request.url = parseUrl(startLine)
-	params, err := parseParams(startLine)
+	request.requestURI = strings.Split(startLine, " ")[1]
+	request.proto = parseProto(startLine)
+	params, err := parseParams(startLine, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed parsing params: %s", err)
 	}
 	request.params = params
 
 	// Handle headers
-	headerLines, headers, err := parseHeaders(reader)
+	headers, err := parseHeaders(reader, &remaining)
 	if err != nil {
-		return nil, fmt.Errorf("failed parsing headers: %s", err)
+		return nil, fmt.Errorf("failed parsing headers: %w", err)
 	}
 	request.headers = headers
-	contentLength, err := getContentLength(headerLines)
-	if err != nil {
-		return nil, fmt.Errorf("content length is specified but failed retrieving it: %s", err)
+
+	// Handle body, it's left on the reader until the handler asks for it
+	if headers.Has(TransferEncoding) {
+		// Both framings at once is how request smuggling starts, refuse instead of picking one (RFC 9112 6.3)
+		if headers.Has(ContentLength) {
+			return nil, fmt.Errorf("request has both Transfer-Encoding and Content-Length")
+		}
+
+		transferEncoding := strings.Join(headers.Values(TransferEncoding), ", ")
+		if !strings.EqualFold(transferEncoding, "chunked") {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedTransferEncoding, transferEncoding)
+		}
+
+		request.trailers = Headers{}
+		request.stream = newChunkedBody(reader, request.trailers)
+		request.stream.onEOF = options.OnBodyEOF
+		return &request, nil
 	}
 
-	// Handle body
-	body, err := parseBody(reader, contentLength)
+	contentLength, err := getContentLength(headers)
 	if err != nil {
-		return nil, fmt.Errorf("failed parsing body: %s", err)
+		return nil, fmt.Errorf("content length is specified but failed retrieving it: %s", err)
+	}
+	request.stream = newBody(reader, int64(contentLength))
+	request.stream.onEOF = options.OnBodyEOF
+	if contentLength == 0 {
+		request.stream.reachedEOF()
 	}
 
-	request.body = body
 	return &request, nil
 }
 
-func parseStartline(reader *bufio.Reader) (string, error) {
-	startLine, err := reader.ReadString('\n')
+func parseStartline(reader *bufio.Reader, remaining *int) (string, error) {
+	startLine, err := readLine(reader, remaining)
+	if errors.Is(err, ErrHeaderTooLarge) {
+		return "", ErrURITooLong
+	}
 	if err != nil {
 		return "", err
 	}
@@ -59,9 +116,40 @@ func parseStartline(reader *bufio.Reader) (string, error) {
 		return "", fmt.Errorf("expected startline to have method, url and http version. One or more is missing: %s", startLine)
 	}
 
+	switch proto := parseProto(startLine); {
+	case proto == "HTTP/1.0" || proto == "HTTP/1.1":
+	case len(proto) == 8 && strings.HasPrefix(proto, "HTTP/") && proto[6] == '.':
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedVersion, proto)
+	default:
+		return "", fmt.Errorf("malformed HTTP version: %s", proto)
+	}
+
 	return startLine, nil
 }
 
+// readLine reads up to and including the next \n, without ever buffering more than remaining bytes.
+func readLine(reader *bufio.Reader, remaining *int) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > *remaining {
+			return "", ErrHeaderTooLarge
+		}
+
+		if errors.Is(err, bufio.ErrBufferFull) { // line is longer than the reader's buffer, keep going
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		*remaining -= len(line)
+		return string(line), nil
+	}
+}
+
 func parseMethod(startLine string) Request {
 	return Request(strings.Split(startLine, " ")[0])
 }
@@ -78,7 +166,11 @@ func parseUrl(startLine string) string {
 	return separatedUrl[0]
 }
 
-func parseParams(startLine string) (map[string]string, error) {
+func parseProto(startLine string) string {
+	return strings.TrimSpace(strings.Split(startLine, " ")[2])
+}
+
+func parseParams(startLine string, logger *slog.Logger) (map[string]string, error) {
 	params := make(map[string]string)
 	endpoint := strings.Split(startLine, " ")[1]
 
@@ -96,7 +188,7 @@ func parseParams(startLine string) (map[string]string, error) {
 	for _, entry := range pr {
 		parts := strings.Split(entry, "=")
 		if len(parts) != 2 {
-			fmt.Printf("failed decoding parameter on input: %s", entry)
+			logger.Debug("skipping malformed query parameter", "param", entry)
 			continue
 		}
 		key, value := parts[0], parts[1]
@@ -111,14 +203,12 @@ func parseParams(startLine string) (map[string]string, error) {
 	return params, nil
 }
 
-func parseHeaders(reader *bufio.Reader) ([]string, map[string]string, error) {
-	var lines []string
-	headers := make(map[string]string)
-	var hasHost bool
+func parseHeaders(reader *bufio.Reader, remaining *int) (Headers, error) {
+	headers := Headers{}
 	for {
-		line, err := reader.ReadString('\n')
+		line, err := readLine(reader, remaining)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed decoding header, err: %s", err)
+			return nil, fmt.Errorf("failed decoding header, err: %w", err)
 		}
 
 		// body starts
@@ -128,55 +218,44 @@ func parseHeaders(reader *bufio.Reader) ([]string, map[string]string, error) {
 
 		// Validate "value: key" format
 		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			return nil, nil, fmt.Errorf("malformed header format")
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("malformed header format")
 		}
 
-		headerKey := strings.TrimSpace(strings.ToLower(parts[0]))
-		headerValue := strings.TrimSpace(strings.ToLower(parts[1]))
-
-		// Validate host exists
-		if headerKey == "host" && headerValue != "" {
-			hasHost = true
-		}
+		headerKey := HeaderType(strings.TrimSpace(parts[0]))
+		headerValue := strings.TrimSpace(parts[1])
 
 		// Validate content length value
-		if headerKey == "content-length" {
+		if canonicalKey(headerKey) == string(ContentLength) {
 			length, err := strconv.Atoi(headerValue)
 			if err != nil || length < 0 {
-				return nil, nil, fmt.Errorf("invalid content length value: %s", err)
+				return nil, fmt.Errorf("invalid content length value: %s", err)
 			}
 		}
 
-		headers[headerKey] = headerValue
-		lines = append(lines, line)
+		headers.Add(headerKey, headerValue)
 	}
 
-	if !hasHost {
-		return nil, nil, fmt.Errorf("failed because no host header was present")
+	// Validate host exists
+	if headers.Get(Host) == "" {
+		return nil, fmt.Errorf("failed because no host header was present")
 	}
 
-	return lines, headers, nil
+	return headers, nil
 }
 
-func getContentLength(headers []string) (int, error) {
-	for _, hder := range headers {
-		h := strings.Split(hder, ":")
-		if h[0] == "Content-Length" {
-			length, _ := strconv.Atoi(strings.TrimSpace(h[1])) // validation of content length handled in header parser
-			return length, nil
-		}
+// getContentLength returns the validated Content-Length, repeats are only allowed when they agree (RFC 9110 8.6).
+func getContentLength(headers Headers) (int, error) {
+	values := headers.Values(ContentLength)
+	if len(values) == 0 {
+		return 0, nil
 	}
 
-	return 0, nil
-}
-
-func parseBody(reader *bufio.Reader, contentLength int) (string, error) {
-	body := make([]byte, contentLength)
-	n, err := io.ReadFull(reader, body)
-	if errors.Is(err, io.ErrUnexpectedEOF) {
-		return "", err
+	for _, value := range values[1:] {
+		if value != values[0] {
+			return 0, fmt.Errorf("conflicting values %q and %q", values[0], value)
+		}
 	}
 
-	return string(body[:n]), nil
+	return strconv.Atoi(values[0]) // validation of content length handled in header parser
 }
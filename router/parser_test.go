@@ -2,6 +2,8 @@ package router
 
 import (
 	"bufio"
+	"errors"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -71,6 +73,7 @@ func TestParse_Headers(t *testing.T) {
 			"POST /api/data HTTP/1.1\r\nHost: example.com\r\nContent-Length: abc\r\n\r\n",
 			"GET / HTTP/1.1\r\nUser-Agent: test\r\n\r\n",
 			"GET / HTTP/1.1\r\nHost example.com\r\n\r\n",
+			"POST /api/data HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\n",
 		}
 
 		for _, req := range requests {
@@ -82,6 +85,23 @@ func TestParse_Headers(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("values kept verbatim", func(t *testing.T) {
+		req := "GET / HTTP/1.1\r\nHost: example.com\r\nauthorization: Bearer AbC123\r\nSet-Cookie: a=1\r\nset-cookie: B=2\r\n\r\n"
+		request, err := Parse(bufio.NewReader(strings.NewReader(req)))
+		if err != nil {
+			t.Fatalf("failed parsing request: %s", err)
+		}
+
+		if value, _ := request.GetHeader("Authorization"); value != "Bearer AbC123" {
+			t.Errorf("expected authorization %q but got %q", "Bearer AbC123", value)
+		}
+
+		cookies := request.Headers().Values(SetCookie)
+		if !slices.Equal(cookies, []string{"a=1", "B=2"}) {
+			t.Errorf("expected both cookies in order but got %v", cookies)
+		}
+	})
 }
 
 // Add edge case for empty params
@@ -270,3 +290,204 @@ func TestParse_Body(t *testing.T) {
 		}
 	}
 }
+
+func TestParseWithOptions_MaxHeaderBytes(t *testing.T) {
+	requests := []struct {
+		request        string
+		maxHeaderBytes int
+		expectedErr    error
+	}{
+		{
+			request:        "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			maxHeaderBytes: 64,
+			expectedErr:    nil,
+		},
+		{
+			request:        "GET / HTTP/1.1\r\nHost: example.com\r\nCookie: " + strings.Repeat("a", 64) + "\r\n\r\n",
+			maxHeaderBytes: 64,
+			expectedErr:    ErrHeaderTooLarge,
+		},
+		{
+			request:        "GET /" + strings.Repeat("a", 8192) + " HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			maxHeaderBytes: 4096,
+			expectedErr:    ErrURITooLong,
+		},
+		{
+			request:        "GET /" + strings.Repeat("a", 8192) + " HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			maxHeaderBytes: 0,
+			expectedErr:    nil,
+		},
+	}
+
+	for _, tt := range requests {
+		reader := bufio.NewReader(strings.NewReader(tt.request))
+		_, err := ParseWithOptions(reader, ParseOptions{MaxHeaderBytes: tt.maxHeaderBytes})
+
+		if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+			t.Errorf("expected %v but got %v", tt.expectedErr, err)
+		}
+
+		if tt.expectedErr == nil && err != nil {
+			t.Errorf("failed parsing request: %s", err)
+		}
+	}
+}
+
+func TestParse_Version(t *testing.T) {
+	requests := []struct {
+		request     string
+		shouldFail  bool
+		expectedErr error
+	}{
+		{
+			request:    "GET / HTTP/1.0\r\nHost: example.com\r\n\r\n",
+			shouldFail: false,
+		},
+		{
+			request:    "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			shouldFail: false,
+		},
+		{
+			request:     "GET / HTTP/2.0\r\nHost: example.com\r\n\r\n",
+			shouldFail:  true,
+			expectedErr: ErrUnsupportedVersion,
+		},
+		{
+			request:    "GET / HTTX/1.1\r\nHost: example.com\r\n\r\n",
+			shouldFail: true,
+		},
+	}
+
+	for _, tt := range requests {
+		reader := bufio.NewReader(strings.NewReader(tt.request))
+		_, err := Parse(reader)
+
+		if tt.shouldFail && err == nil {
+			t.Errorf("expected parser to fail on: %s", tt.request)
+		}
+
+		if !tt.shouldFail && err != nil {
+			t.Errorf("failed parsing request: %s", err)
+		}
+
+		if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+			t.Errorf("expected %v but got %v", tt.expectedErr, err)
+		}
+	}
+}
+
+func TestParseWithOptions_OnBodyEOF(t *testing.T) {
+	requests := []struct {
+		name           string
+		request        string
+		expectedBefore bool // called before the handler reads the body
+		expectedAfter  bool // called once the body has been read
+	}{
+		{
+			name:           "no body",
+			request:        "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			expectedBefore: true,
+			expectedAfter:  true,
+		},
+		{
+			name:           "content length",
+			request:        "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nHello",
+			expectedBefore: false,
+			expectedAfter:  true,
+		},
+		{
+			name:           "chunked",
+			request:        "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nHello\r\n0\r\n\r\n",
+			expectedBefore: false,
+			expectedAfter:  true,
+		},
+		{
+			name:           "truncated body",
+			request:        "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 10\r\n\r\nHello",
+			expectedBefore: false,
+			expectedAfter:  false,
+		},
+	}
+
+	for _, tt := range requests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			reader := bufio.NewReader(strings.NewReader(tt.request))
+			request, err := ParseWithOptions(reader, ParseOptions{OnBodyEOF: func() { calls++ }})
+			if err != nil {
+				t.Fatalf("failed parsing request: %s", err)
+			}
+
+			if (calls == 1) != tt.expectedBefore {
+				t.Errorf("expected called before reading the body to be %v but got %d calls", tt.expectedBefore, calls)
+			}
+
+			request.Body()
+			request.BodyReader().Close()
+			if (calls == 1) != tt.expectedAfter || calls > 1 {
+				t.Errorf("expected called after reading the body to be %v but got %d calls", tt.expectedAfter, calls)
+			}
+		})
+	}
+}
+
+func TestParse_RequestLine(t *testing.T) {
+	requests := []struct {
+		request            string
+		expectedStartLine  string
+		expectedRequestURI string
+		expectedHost       string
+		expectedProto      string
+	}{
+		{
+			request:            "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			expectedStartLine:  "GET / HTTP/1.1",
+			expectedRequestURI: "/",
+			expectedHost:       "example.com",
+			expectedProto:      "HTTP/1.1",
+		},
+		{
+			request:            "GET /search?q=go%20http&page=2 HTTP/1.0\r\nhost: example.com:8080\r\n\r\n",
+			expectedStartLine:  "GET /search?q=go%20http&page=2 HTTP/1.0",
+			expectedRequestURI: "/search?q=go%20http&page=2",
+			expectedHost:       "example.com:8080",
+			expectedProto:      "HTTP/1.0",
+		},
+		{
+			request:            "OPTIONS * HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			expectedStartLine:  "OPTIONS * HTTP/1.1",
+			expectedRequestURI: "*",
+			expectedHost:       "example.com",
+			expectedProto:      "HTTP/1.1",
+		},
+	}
+
+	for _, tt := range requests {
+		t.Run(tt.expectedStartLine, func(t *testing.T) {
+			request, err := Parse(bufio.NewReader(strings.NewReader(tt.request)))
+			if err != nil {
+				t.Fatalf("failed parsing request: %s", err)
+			}
+
+			if request.StartLine() != tt.expectedStartLine {
+				t.Errorf("expected start line %q but got %q", tt.expectedStartLine, request.StartLine())
+			}
+
+			if request.RequestURI() != tt.expectedRequestURI {
+				t.Errorf("expected request URI %q but got %q", tt.expectedRequestURI, request.RequestURI())
+			}
+
+			if request.Host() != tt.expectedHost {
+				t.Errorf("expected host %q but got %q", tt.expectedHost, request.Host())
+			}
+
+			if request.Proto() != tt.expectedProto {
+				t.Errorf("expected proto %q but got %q", tt.expectedProto, request.Proto())
+			}
+
+			if request.RemoteAddr() != nil || request.LocalAddr() != nil {
+				t.Errorf("expected no addresses for a request that didn't come in over a connection")
+			}
+		})
+	}
+}
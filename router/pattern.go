@@ -0,0 +1,121 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// paramTypes are the named constraints usable as :name<type>.
+var paramTypes = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// routeParam is a param or wildcard in a route pattern.
+type routeParam struct {
+	name       string
+	expr       string         // the constraint as written, after resolving a named type
+	constraint *regexp.Regexp // nil when any value goes
+	wildcard   bool
+}
+
+// parsePattern returns the params of pattern in order. Params take up a whole segment and come as :name,
+// :name<type> with a type from paramTypes, {name} or {name:regexp}. A *name wildcard may end the pattern.
+// Constraints are compiled here, once per route.
+func parsePattern(pattern string) ([]routeParam, error) {
+	var params []routeParam
+	segments := splitSegments(pattern)
+	for i, segment := range segments {
+		if !isDynamic(segment) {
+			continue
+		}
+
+		param, err := parseParam(segment)
+		if err != nil {
+			return nil, fmt.Errorf("failed adding route %s: %w", pattern, err)
+		}
+
+		if param.wildcard && i != len(segments)-1 {
+			return nil, fmt.Errorf("failed adding route %s, wildcard %s must be the last segment", pattern, segment)
+		}
+
+		params = append(params, param)
+	}
+
+	return params, nil
+}
+
+func parseParam(segment string) (routeParam, error) {
+	var param routeParam
+	switch segment[0] {
+	case '*':
+		param = routeParam{name: segment[1:], wildcard: true}
+	case '{':
+		if !strings.HasSuffix(segment, "}") {
+			return param, fmt.Errorf("param %s is missing its closing brace", segment)
+		}
+		param.name, param.expr, _ = strings.Cut(segment[1:len(segment)-1], ":")
+	default:
+		name, kind, found := strings.Cut(segment[1:], "<")
+		param.name = name
+		if found {
+			if !strings.HasSuffix(kind, ">") {
+				return param, fmt.Errorf("param %s is missing its closing >", segment)
+			}
+
+			expr, exists := paramTypes[strings.TrimSuffix(kind, ">")]
+			if !exists {
+				return param, fmt.Errorf("param %s has unknown type %s", segment, strings.TrimSuffix(kind, ">"))
+			}
+			param.expr = expr
+		}
+	}
+
+	if param.name == "" {
+		return param, fmt.Errorf("param %s needs a name, e.g. :id or *filepath", segment)
+	}
+
+	if param.expr != "" {
+		constraint, err := regexp.Compile("^(?:" + param.expr + ")$")
+		if err != nil {
+			return param, fmt.Errorf("param %s has an invalid constraint: %w", segment, err)
+		}
+		param.constraint = constraint
+	}
+
+	return param, nil
+}
+
+// splitSegments splits pattern on slashes, except for the ones inside braces, e.g. in {id:[0-9]{3}}.
+func splitSegments(pattern string) []string {
+	var segments []string
+	depth, start := 0, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				segments = append(segments, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(segments, pattern[start:])
+}
+
+// segmentEnd returns the index of the first slash in pattern outside braces, or its length when there's none.
+func segmentEnd(pattern string) int {
+	return len(splitSegments(pattern)[0])
+}
+
+func isDynamic(segment string) bool {
+	return segment != "" && (segment[0] == ':' || segment[0] == '{' || segment[0] == '*')
+}
@@ -0,0 +1,59 @@
+package router
+
+import (
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		pattern       string
+		expectedNames []string
+		expectedExprs []string
+		expectErr     bool
+	}{
+		{pattern: "/users", expectedNames: nil},
+		{pattern: "/users/:id", expectedNames: []string{"id"}, expectedExprs: []string{""}},
+		{pattern: "/users/:id<int>", expectedNames: []string{"id"}, expectedExprs: []string{paramTypes["int"]}},
+		{pattern: "/users/{id:[0-9]+}/posts/{slug}", expectedNames: []string{"id", "slug"}, expectedExprs: []string{"[0-9]+", ""}},
+		{pattern: "/codes/{code:[A-Z]{2}/?}", expectedNames: []string{"code"}, expectedExprs: []string{"[A-Z]{2}/?"}},
+		{pattern: "/static/*filepath", expectedNames: []string{"filepath"}, expectedExprs: []string{""}},
+		{pattern: "/files/a:b", expectedNames: nil},
+		{pattern: "/users/:id<float>", expectErr: true},
+		{pattern: "/users/:id<int", expectErr: true},
+		{pattern: "/users/{id:[0-9}", expectErr: true},
+		{pattern: "/users/{id:(}", expectErr: true},
+		{pattern: "/users/:", expectErr: true},
+		{pattern: "/static/*", expectErr: true},
+		{pattern: "/static/*filepath/edit", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			params, err := parsePattern(tt.pattern)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("expected an error but got params %v", params)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed parsing pattern: %s", err)
+			}
+
+			if len(params) != len(tt.expectedNames) {
+				t.Fatalf("expected params %v but got %v", tt.expectedNames, params)
+			}
+
+			for i, param := range params {
+				if param.name != tt.expectedNames[i] || param.expr != tt.expectedExprs[i] {
+					t.Errorf("expected param %s with constraint %q but got %s with %q", tt.expectedNames[i], tt.expectedExprs[i], param.name, param.expr)
+				}
+
+				if (param.expr == "") != (param.constraint == nil) {
+					t.Errorf("expected param %s to be compiled only when constrained", param.name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package router
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Client is who sent a request, as far as the trusted proxies in front of the server can tell.
+type Client struct {
+	IP     netip.Addr // invalid when the request didn't come in over a connection
+	Scheme string     // http or https
+	Host   string     // the host the client asked for
+}
+
+// ParseTrustedProxies parses CIDRs like 10.0.0.0/8 for ResolveClient, a bare address trusts just that one.
+func ParseTrustedProxies(cidrs ...string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// ResolveClient works out the client of a request that may have passed through proxies. Forwarding headers are
+// only believed when the connection came from a trusted proxy: Forwarded (RFC 7239) is preferred, then
+// X-Forwarded-For along with X-Forwarded-Proto and X-Forwarded-Host, then X-Real-IP. Addresses are read right to
+// left, the first one that isn't a trusted proxy is the client, anything left of it could be made up by the client.
+func ResolveClient(request HTTPRequest, trusted []netip.Prefix) Client {
+	client := directClient(request)
+	if !isTrusted(client.IP, trusted) {
+		return client
+	}
+
+	headers := request.Headers()
+	switch {
+	case headers.Has(Forwarded):
+		elements := parseForwarded(headers.Values(Forwarded))
+		hops := make([]netip.Addr, len(elements))
+		for i, element := range elements {
+			hops[i] = parseNode(element["for"])
+		}
+
+		i := clientHop(hops, trusted)
+		if i < 0 || i == len(hops) {
+			return client
+		}
+
+		// The element naming the client was added by the proxy it connected to, so it describes the original request
+		client.IP = hops[i]
+		if scheme, ok := parseScheme(elements[i]["proto"]); ok {
+			client.Scheme = scheme
+		}
+		if host := elements[i]["host"]; host != "" {
+			client.Host = host
+		}
+	case headers.Has(XForwardedFor):
+		var hops []netip.Addr
+		for _, node := range splitList(headers.Values(XForwardedFor)) {
+			hops = append(hops, parseNode(node))
+		}
+
+		i := clientHop(hops, trusted)
+		if i < 0 || i == len(hops) {
+			return client
+		}
+
+		// Proxies set these rather than append to them, the last value is the one the nearest proxy set
+		client.IP = hops[i]
+		if protos := splitList(headers.Values(XForwardedProto)); len(protos) > 0 {
+			if scheme, ok := parseScheme(protos[len(protos)-1]); ok {
+				client.Scheme = scheme
+			}
+		}
+		if hosts := splitList(headers.Values(XForwardedHost)); len(hosts) > 0 && hosts[len(hosts)-1] != "" {
+			client.Host = hosts[len(hosts)-1]
+		}
+	case headers.Has(XRealIP):
+		if ip := parseNode(headers.Get(XRealIP)); ip.IsValid() {
+			client.IP = ip
+		}
+	}
+
+	return client
+}
+
+// directClient is the client as seen on the connection, without looking at forwarding headers.
+func directClient(request HTTPRequest) Client {
+	client := Client{Scheme: "http", Host: request.Host()}
+	if request.TLS() != nil {
+		client.Scheme = "https"
+	}
+
+	if addr := request.RemoteAddr(); addr != nil {
+		if addrPort, err := netip.ParseAddrPort(addr.String()); err == nil {
+			client.IP = addrPort.Addr().Unmap()
+		}
+	}
+
+	return client
+}
+
+// clientHop returns the index of the client in hops, the addresses a request passed through from left to right.
+// It stops at an address it can't parse, e.g. "unknown" or an obfuscated one, since it can't tell whether to
+// trust anything further left, and returns len(hops) when that's the last one. It returns -1 when hops is empty.
+func clientHop(hops []netip.Addr, trusted []netip.Prefix) int {
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !hops[i].IsValid() {
+			return i + 1
+		}
+
+		if i == 0 || !isTrusted(hops[i], trusted) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func isTrusted(ip netip.Addr, trusted []netip.Prefix) bool {
+	if !ip.IsValid() {
+		return false
+	}
+
+	for _, prefix := range trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseForwarded splits Forwarded header values into their elements, with parameter names lowercased and
+// quotes removed from values, e.g. `for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"`.
+func parseForwarded(values []string) []map[string]string {
+	var elements []map[string]string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			params := make(map[string]string)
+			for _, pair := range splitQuoted(element, ';') {
+				name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found {
+					continue
+				}
+				params[strings.ToLower(strings.TrimSpace(name))] = unquote(strings.TrimSpace(value))
+			}
+			elements = append(elements, params)
+		}
+	}
+
+	return elements
+}
+
+// parseNode parses a node from a forwarding header, an IP with or without a port, IPv6 possibly in brackets.
+// Anything else, like "unknown", gives an invalid address.
+func parseNode(node string) netip.Addr {
+	node = strings.TrimSpace(node)
+	if addrPort, err := netip.ParseAddrPort(node); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")); err == nil {
+		return addr.Unmap()
+	}
+
+	return netip.Addr{}
+}
+
+func parseScheme(scheme string) (string, bool) {
+	scheme = strings.ToLower(strings.TrimSpace(scheme))
+	return scheme, scheme == "http" || scheme == "https"
+}
+
+// splitList splits comma-separated header values into their trimmed items.
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+
+	return items
+}
+
+// splitQuoted splits s on sep, except inside quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+
+	var unquoted strings.Builder
+	for i := 1; i < len(value)-1; i++ {
+		if value[i] == '\\' && i+1 < len(value)-1 {
+			i++
+		}
+		unquoted.WriteByte(value[i])
+	}
+
+	return unquoted.String()
+}
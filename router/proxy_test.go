@@ -0,0 +1,209 @@
+package router
+
+import (
+	"crypto/tls"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestResolveClient(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8", "2001:db8::/32", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("failed parsing trusted proxies: %s", err)
+	}
+
+	tests := []struct {
+		name           string
+		remote         string
+		headers        Headers
+		tls            bool
+		expectedIP     string
+		expectedScheme string
+		expectedHost   string
+	}{
+		{
+			name:           "direct connection",
+			remote:         "203.0.113.7:5000",
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "untrusted peer can't spoof",
+			remote:         "203.0.113.7:5000",
+			headers:        Headers{"X-Forwarded-For": {"1.1.1.1"}, "X-Forwarded-Proto": {"https"}, "X-Real-Ip": {"1.1.1.1"}},
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "tls without proxies",
+			remote:         "203.0.113.7:5000",
+			tls:            true,
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "https",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "x-forwarded-for through a trusted proxy",
+			remote:         "10.0.0.2:5000",
+			headers:        Headers{"X-Forwarded-For": {"203.0.113.7"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"shop.example.com"}},
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "https",
+			expectedHost:   "shop.example.com",
+		},
+		{
+			name:           "x-forwarded-for read right to left",
+			remote:         "10.0.0.2:5000",
+			headers:        Headers{"X-Forwarded-For": {"1.1.1.1, 203.0.113.7", "10.0.0.3"}},
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "x-forwarded-for with only trusted proxies",
+			remote:         "10.0.0.2:5000",
+			headers:        Headers{"X-Forwarded-For": {"10.0.0.4, 10.0.0.3"}},
+			expectedIP:     "10.0.0.4",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "x-forwarded-for with garbage stops at the proxy",
+			remote:         "10.0.0.2:5000",
+			headers:        Headers{"X-Forwarded-For": {"203.0.113.7, not-an-ip"}},
+			expectedIP:     "10.0.0.2",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "x-forwarded-proto from the nearest proxy",
+			remote:         "10.0.0.2:5000",
+			headers:        Headers{"X-Forwarded-For": {"203.0.113.7"}, "X-Forwarded-Proto": {"https, http"}},
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "invalid x-forwarded-proto is ignored",
+			remote:         "10.0.0.2:5000",
+			headers:        Headers{"X-Forwarded-For": {"203.0.113.7"}, "X-Forwarded-Proto": {"gopher"}},
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "forwarded",
+			remote:         "192.0.2.1:5000",
+			headers:        Headers{"Forwarded": {`for=203.0.113.7;proto=https;host=shop.example.com`}},
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "https",
+			expectedHost:   "shop.example.com",
+		},
+		{
+			name:   "forwarded read right to left",
+			remote: "192.0.2.1:5000",
+			headers: Headers{"Forwarded": {
+				`for=1.1.1.1;proto=http`,
+				`For="[2606:4700::17]:4711";proto=https;host="shop.example.com", for=10.0.0.3;proto=http`,
+			}},
+			expectedIP:     "2606:4700::17",
+			expectedScheme: "https",
+			expectedHost:   "shop.example.com",
+		},
+		{
+			name:           "forwarded untrusted hop wins",
+			remote:         "192.0.2.1:5000",
+			headers:        Headers{"Forwarded": {`for="[2001:db8::1]", for=198.51.100.9;proto=https`}},
+			expectedIP:     "198.51.100.9",
+			expectedScheme: "https",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "forwarded with an unknown node stops at the proxy",
+			remote:         "192.0.2.1:5000",
+			headers:        Headers{"Forwarded": {`for=203.0.113.7, for=unknown`}},
+			expectedIP:     "192.0.2.1",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "forwarded wins over x-forwarded-for",
+			remote:         "10.0.0.2:5000",
+			headers:        Headers{"Forwarded": {`for=203.0.113.7`}, "X-Forwarded-For": {"198.51.100.9"}},
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "x-real-ip",
+			remote:         "[::ffff:10.0.0.2]:5000",
+			headers:        Headers{"X-Real-Ip": {"203.0.113.7"}},
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := Headers{"Host": {"example.com"}}
+			for key, values := range tt.headers {
+				headers[key] = values
+			}
+
+			remote, err := net.ResolveTCPAddr("tcp", tt.remote)
+			if err != nil {
+				t.Fatalf("failed resolving %s: %s", tt.remote, err)
+			}
+
+			request := &httpRequest{headers: headers, remote: remote}
+			if tt.tls {
+				request.tls = &tls.ConnectionState{}
+			}
+
+			client := ResolveClient(request, trusted)
+			if client.IP != netip.MustParseAddr(tt.expectedIP) {
+				t.Errorf("expected client IP %s but got %s", tt.expectedIP, client.IP)
+			}
+
+			if client.Scheme != tt.expectedScheme {
+				t.Errorf("expected scheme %s but got %s", tt.expectedScheme, client.Scheme)
+			}
+
+			if client.Host != tt.expectedHost {
+				t.Errorf("expected host %s but got %s", tt.expectedHost, client.Host)
+			}
+
+			request.SetClient(client)
+			if request.ClientIP() != client.IP || request.Scheme() != client.Scheme || request.OriginalHost() != client.Host {
+				t.Errorf("expected the request to report the resolved client")
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := ParseTrustedProxies("10.1.2.3/8", "192.0.2.1", "::1")
+	if err != nil {
+		t.Fatalf("failed parsing trusted proxies: %s", err)
+	}
+
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("::1/128"),
+	}
+	for i := range expected {
+		if prefixes[i] != expected[i] {
+			t.Errorf("expected %s but got %s", expected[i], prefixes[i])
+		}
+	}
+
+	for _, cidr := range []string{"10.0.0.0/33", "proxy.internal"} {
+		if _, err := ParseTrustedProxies(cidr); err == nil {
+			t.Errorf("expected %q to be rejected", cidr)
+		}
+	}
+}
@@ -1,7 +1,13 @@
 package router
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
 	"strings"
 )
 
@@ -17,31 +23,72 @@ const (
 	Options Request = "OPTIONS"
 )
 
+// Methods are the methods Router.Any registers a route for.
+var Methods = []Request{Get, Head, Post, Put, Patch, Delete, Options}
+
 type HTTPRequest interface {
 	Params() map[string]string
 	Body() string
+	BodyReader() io.ReadCloser
+	Trailers() Headers
 	GetQueryParam(key string) (string, error)
 	GetURLParam(key string) (string, error)
+	GetURLParamInt(key string) (int, error)
+	GetURLParamUUID(key string) (UUID, error)
 	Url() string
 	Method() Request
+	Proto() string
+	Host() string
+	RequestURI() string
+	StartLine() string
+	RemoteAddr() net.Addr
+	LocalAddr() net.Addr
+	SetRemoteAddr(addr net.Addr)
+	SetLocalAddr(addr net.Addr)
+	ClientIP() netip.Addr
+	Scheme() string
+	OriginalHost() string
+	SetClient(client Client)
 	SetRouterURL(url string)
+	SetURLParams(params map[string]string)
 	GetHeader(key string) (string, error)
+	Headers() Headers
+	KeepAlive() bool
+	TLS() *tls.ConnectionState
+	SetTLS(state *tls.ConnectionState)
+	Context() context.Context
+	WithContext(ctx context.Context) HTTPRequest
+	SetValue(key, value any)
+	Value(key any) (any, bool)
 }
 
 type httpRequest struct {
-	startLine string
-	headers   map[string]string
-	body      string
-	params    map[string]string
-	url       string
-	routerURL string
-	method    Request
+	startLine  string
+	headers    Headers
+	body       string
+	stream     *body
+	buffered   bool
+	trailers   Headers
+	params     map[string]string
+	urlParams  map[string]string
+	url        string
+	requestURI string
+	routerURL  string
+	method     Request
+	proto      string
+	tls        *tls.ConnectionState
+	remote     net.Addr
+	local      net.Addr
+	client     *Client
+	ctx        context.Context
+	values     *values
 }
 
 func NewHTTPRequest() HTTPRequest {
 	return &httpRequest{
 		params:  make(map[string]string),
-		headers: make(map[string]string),
+		headers: Headers{},
+		values:  &values{},
 	}
 }
 
@@ -58,22 +105,70 @@ func (r *httpRequest) GetQueryParam(key string) (string, error) {
 	return value, nil
 }
 
+// GetURLParam returns the value matched for a param of the route, e.g. "id" for "/users/:id".
+// The leading colon is optional.
 func (r *httpRequest) GetURLParam(key string) (string, error) {
-	requestUrlParts := strings.Split(r.url, "/")
-	urlParts := strings.Split(r.routerURL, "/")
-	for i, part := range urlParts {
-		if strings.TrimPrefix(part, ":") == strings.TrimPrefix(key, ":") {
-			return requestUrlParts[i], nil
-		}
+	value, exists := r.urlParams[strings.TrimPrefix(key, ":")]
+	if !exists {
+		return "", fmt.Errorf("no url param matching the given value")
 	}
 
-	return "", fmt.Errorf("no url param matching the given value")
+	return value, nil
 }
 
+// GetURLParamInt returns a url param as an int, e.g. for "/users/:id<int>".
+func (r *httpRequest) GetURLParamInt(key string) (int, error) {
+	value, err := r.GetURLParam(key)
+	if err != nil {
+		return 0, err
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("url param %s is not an int: %w", key, err)
+	}
+
+	return number, nil
+}
+
+// GetURLParamUUID returns a url param as a UUID, e.g. for "/orders/:id<uuid>".
+func (r *httpRequest) GetURLParamUUID(key string) (UUID, error) {
+	value, err := r.GetURLParam(key)
+	if err != nil {
+		return UUID{}, err
+	}
+
+	return ParseUUID(value)
+}
+
+// Body reads the rest of the body into memory on first use and keeps returning it afterwards.
+// A body that fails halfway, for instance because the client disconnected, returns what was read.
 func (r *httpRequest) Body() string {
+	if r.stream != nil && !r.buffered {
+		data, _ := io.ReadAll(r.stream)
+		r.body = string(data)
+		r.buffered = true
+	}
+
 	return r.body
 }
 
+// BodyReader streams the body from the connection, limited to its Content-Length. Closing it discards
+// anything left unread, which the server also does once the handler returns.
+func (r *httpRequest) BodyReader() io.ReadCloser {
+	if r.stream == nil || r.buffered {
+		return &bufferedBody{Reader: strings.NewReader(r.body), stream: r.stream}
+	}
+
+	return r.stream
+}
+
+// Trailers holds the trailer fields of a chunked body.
+// They're only filled in once the body has been read to the end.
+func (r *httpRequest) Trailers() Headers {
+	return r.trailers
+}
+
 func (r *httpRequest) Url() string {
 	return r.url
 }
@@ -82,19 +177,167 @@ func (r *httpRequest) Method() Request {
 	return r.method
 }
 
+// Proto is the HTTP version from the start line, e.g. HTTP/1.1.
+func (r *httpRequest) Proto() string {
+	return r.proto
+}
+
+// Host is the host the request was sent to, from the Host header, e.g. example.com:8080.
+func (r *httpRequest) Host() string {
+	return r.headers.Get(Host)
+}
+
+// RequestURI is the request target exactly as the client sent it, query included, e.g. /search?q=go%20http.
+func (r *httpRequest) RequestURI() string {
+	return r.requestURI
+}
+
+// StartLine is the first line of the request without its line ending, e.g. GET /users HTTP/1.1.
+func (r *httpRequest) StartLine() string {
+	return strings.TrimRight(r.startLine, "\r\n")
+}
+
+// RemoteAddr is the address of the client, or of the last proxy in front of it.
+// It is nil for requests that didn't come in over a connection.
+func (r *httpRequest) RemoteAddr() net.Addr {
+	return r.remote
+}
+
+// LocalAddr is the address the request was accepted on, useful when listening on several.
+func (r *httpRequest) LocalAddr() net.Addr {
+	return r.local
+}
+
+func (r *httpRequest) SetRemoteAddr(addr net.Addr) {
+	r.remote = addr
+}
+
+func (r *httpRequest) SetLocalAddr(addr net.Addr) {
+	r.local = addr
+}
+
+// ClientIP is the address of the client, looking past trusted proxies when the server has any configured.
+// Otherwise it's the IP of RemoteAddr.
+func (r *httpRequest) ClientIP() netip.Addr {
+	return r.resolvedClient().IP
+}
+
+// Scheme is http or https, as the client sent the request before any trusted proxies.
+func (r *httpRequest) Scheme() string {
+	return r.resolvedClient().Scheme
+}
+
+// OriginalHost is the host the client asked for before any trusted proxies, Host when there are none.
+func (r *httpRequest) OriginalHost() string {
+	return r.resolvedClient().Host
+}
+
+// SetClient stores the client as worked out by ResolveClient.
+func (r *httpRequest) SetClient(client Client) {
+	r.client = &client
+}
+
+func (r *httpRequest) resolvedClient() Client {
+	if r.client == nil {
+		return directClient(r)
+	}
+
+	return *r.client
+}
+
 func (r *httpRequest) SetRouterURL(url string) {
 	r.routerURL = url
 }
 
+// SetURLParams stores the params matched by the router, keyed by name without the colon.
+func (r *httpRequest) SetURLParams(params map[string]string) {
+	r.urlParams = params
+}
+
 func (r *httpRequest) GetRouterURL() string {
 	return r.routerURL
 }
 
+// GetHeader returns the first value of the header key, matched case-insensitively.
 func (r *httpRequest) GetHeader(key string) (string, error) {
-	value, exists := r.headers[strings.ToLower(key)]
-	if !exists {
+	if !r.headers.Has(HeaderType(key)) {
 		return "", fmt.Errorf("could not find key %s\n", key)
 	}
 
-	return value, nil
+	return r.headers.Get(HeaderType(key)), nil
+}
+
+// Headers returns every request header with its values as the client sent them.
+func (r *httpRequest) Headers() Headers {
+	return r.headers
+}
+
+// KeepAlive reports whether the client wants the connection kept open after the response.
+// An explicit Connection header wins, otherwise HTTP/1.1 defaults to keep-alive and HTTP/1.0 to close.
+func (r *httpRequest) KeepAlive() bool {
+	connection := strings.Join(r.headers.Values(ConnectionHeader), ",")
+	if hasToken(connection, "close") {
+		return false
+	}
+
+	if hasToken(connection, "keep-alive") {
+		return true
+	}
+
+	return r.proto != "HTTP/1.0"
+}
+
+// TLS holds the negotiated TLS version, cipher suite, server name and peer certificates,
+// it is nil when the request didn't come in over TLS.
+func (r *httpRequest) TLS() *tls.ConnectionState {
+	return r.tls
+}
+
+func (r *httpRequest) SetTLS(state *tls.ConnectionState) {
+	r.tls = state
+}
+
+// Context is cancelled when the client disconnects, the write timeout passes, the server shuts down
+// or the handler returns. It is context.Background() for requests that weren't served by a server.
+func (r *httpRequest) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+
+	return r.ctx
+}
+
+// WithContext replaces the request's context and returns the request. Middlewares can't hand a new request
+// to next, so the context is swapped in place and everything later in the chain sees it.
+func (r *httpRequest) WithContext(ctx context.Context) HTTPRequest {
+	if ctx == nil {
+		panic("router: nil context")
+	}
+	r.ctx = ctx
+
+	return r
+}
+
+// SetValue stores value under key for the rest of the request, it's how middlewares hand data like the
+// authenticated user to handlers. Prefer a typed Key, which calls this.
+func (r *httpRequest) SetValue(key, value any) {
+	if r.values == nil { // only for requests put together by hand, Parse and NewHTTPRequest set it up
+		r.values = &values{}
+	}
+	r.values.set(key, value)
+}
+
+// Value returns what was stored under key with SetValue.
+func (r *httpRequest) Value(key any) (any, bool) {
+	return r.values.get(key)
+}
+
+func hasToken(value, token string) bool {
+	for _, part := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -1,6 +1,9 @@
 package router
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 // Test get url param
 func Test_httpRequest_GetQueryParam(t *testing.T) {
@@ -14,7 +17,7 @@ func Test_httpRequest_GetQueryParam(t *testing.T) {
 			expectedValue: "123",
 			request: httpRequest{
 				startLine: "GET /url?test=123 HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    map[string]string{"test": "123"},
 				url:       "/url",
@@ -27,7 +30,7 @@ func Test_httpRequest_GetQueryParam(t *testing.T) {
 			expectedValue: "456",
 			request: httpRequest{
 				startLine: "GET /users?id=456&name=john HTTP/1.1",
-				headers:   map[string]string{"Host": "api.example.com"},
+				headers:   Headers{"Host": {"api.example.com"}},
 				body:      "",
 				params:    map[string]string{"id": "456", "name": "john"},
 				url:       "/users",
@@ -40,7 +43,7 @@ func Test_httpRequest_GetQueryParam(t *testing.T) {
 			expectedValue: "golang",
 			request: httpRequest{
 				startLine: "POST /search HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com", "Content-Type": "application/x-www-form-urlencoded"},
+				headers:   Headers{"Host": {"example.com"}, "Content-Type": {"application/x-www-form-urlencoded"}},
 				body:      "search=golang&limit=10",
 				params:    map[string]string{"search": "golang", "limit": "10"},
 				url:       "/search",
@@ -53,7 +56,7 @@ func Test_httpRequest_GetQueryParam(t *testing.T) {
 			expectedValue: "",
 			request: httpRequest{
 				startLine: "GET /test HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    map[string]string{},
 				url:       "/test",
@@ -66,7 +69,7 @@ func Test_httpRequest_GetQueryParam(t *testing.T) {
 			expectedValue: "abc123xyz",
 			request: httpRequest{
 				startLine: "GET /api/data?token=abc123xyz HTTP/1.1",
-				headers:   map[string]string{"Host": "api.example.com", "Authorization": "Bearer token"},
+				headers:   Headers{"Host": {"api.example.com"}, "Authorization": {"Bearer token"}},
 				body:      "",
 				params:    map[string]string{"token": "abc123xyz"},
 				url:       "/api/data",
@@ -99,9 +102,10 @@ func Test_httpRequest_GetURLParam(t *testing.T) {
 			expectedValue: "123",
 			request: httpRequest{
 				startLine: "GET /url/123 HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
+				urlParams: map[string]string{"id": "123"},
 				url:       "/url/123",
 				routerURL: "/url/:id",
 				method:    "GET",
@@ -112,9 +116,10 @@ func Test_httpRequest_GetURLParam(t *testing.T) {
 			expectedValue: "john",
 			request: httpRequest{
 				startLine: "GET /users/john HTTP/1.1",
-				headers:   map[string]string{"Host": "api.example.com"},
+				headers:   Headers{"Host": {"api.example.com"}},
 				body:      "",
 				params:    nil,
+				urlParams: map[string]string{"username": "john"},
 				url:       "/users/john",
 				routerURL: "/users/:username",
 				method:    "GET",
@@ -125,9 +130,10 @@ func Test_httpRequest_GetURLParam(t *testing.T) {
 			expectedValue: "456",
 			request: httpRequest{
 				startLine: "GET /posts/456/comments/789 HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
+				urlParams: map[string]string{"id": "456", "commentId": "789"},
 				url:       "/posts/456/comments/789",
 				routerURL: "/posts/:id/comments/:commentId",
 				method:    "GET",
@@ -138,9 +144,10 @@ func Test_httpRequest_GetURLParam(t *testing.T) {
 			expectedValue: "789",
 			request: httpRequest{
 				startLine: "GET /posts/456/comments/789 HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
+				urlParams: map[string]string{"id": "456", "commentId": "789"},
 				url:       "/posts/456/comments/789",
 				routerURL: "/posts/:id/comments/:commentId",
 				method:    "GET",
@@ -151,9 +158,10 @@ func Test_httpRequest_GetURLParam(t *testing.T) {
 			expectedValue: "",
 			request: httpRequest{
 				startLine: "GET /url/123 HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
+				urlParams: map[string]string{"id": "123"},
 				url:       "/url/123",
 				routerURL: "/url/:id",
 				method:    "GET",
@@ -164,9 +172,10 @@ func Test_httpRequest_GetURLParam(t *testing.T) {
 			expectedValue: "my-post-title",
 			request: httpRequest{
 				startLine: "GET /blog/my-post-title HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
+				urlParams: map[string]string{"slug": "my-post-title"},
 				url:       "/blog/my-post-title",
 				routerURL: "/blog/:slug",
 				method:    "GET",
@@ -185,3 +194,62 @@ func Test_httpRequest_GetURLParam(t *testing.T) {
 		}
 	}
 }
+
+func Test_httpRequest_KeepAlive(t *testing.T) {
+	requests := []struct {
+		name      string
+		request   httpRequest
+		keepAlive bool
+	}{
+		{
+			name:      "HTTP/1.1 defaults to keep-alive",
+			request:   httpRequest{proto: "HTTP/1.1", headers: Headers{"Host": {"example.com"}}},
+			keepAlive: true,
+		},
+		{
+			name:      "HTTP/1.0 defaults to close",
+			request:   httpRequest{proto: "HTTP/1.0", headers: Headers{"Host": {"example.com"}}},
+			keepAlive: false,
+		},
+		{
+			name:      "HTTP/1.1 with connection close",
+			request:   httpRequest{proto: "HTTP/1.1", headers: Headers{"Host": {"example.com"}, "Connection": {"close"}}},
+			keepAlive: false,
+		},
+		{
+			name:      "HTTP/1.0 with connection keep-alive",
+			request:   httpRequest{proto: "HTTP/1.0", headers: Headers{"Host": {"example.com"}, "Connection": {"keep-alive"}}},
+			keepAlive: true,
+		},
+		{
+			name:      "connection header with multiple tokens",
+			request:   httpRequest{proto: "HTTP/1.1", headers: Headers{"Host": {"example.com"}, "Connection": {"upgrade, close"}}},
+			keepAlive: false,
+		},
+	}
+
+	for _, tt := range requests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.request.KeepAlive() != tt.keepAlive {
+				t.Errorf("expected keep-alive to be %v but got %v", tt.keepAlive, tt.request.KeepAlive())
+			}
+		})
+	}
+}
+
+func Test_httpRequest_Context(t *testing.T) {
+	request := NewHTTPRequest()
+	if request.Context() != context.Background() {
+		t.Errorf("expected a request without a context to use context.Background()")
+	}
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	if returned := request.WithContext(ctx); returned != request {
+		t.Errorf("expected WithContext to return the request itself")
+	}
+
+	if request.Context().Value(key{}) != "value" {
+		t.Errorf("expected the request to carry the new context")
+	}
+}
@@ -1,19 +1,40 @@
 package router
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
 	"strings"
 )
 
 type Router interface {
-	Get(url string, handler func(writer HTTPWriter, request HTTPRequest))
-	Post(url string, handler func(writer HTTPWriter, request HTTPRequest))
-	Put(url string, handler func(writer HTTPWriter, request HTTPRequest))
-	Delete(url string, handler func(writer HTTPWriter, request HTTPRequest))
+	Get(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder
+	Post(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder
+	Put(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder
+	Delete(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder
+	Patch(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder
+	Head(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder
+	Options(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder
+	Handle(method Request, url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder
+	Any(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder
+	URL(name string, params ...string) (string, error)
+	Walk(fn WalkFunc) error
+	CollectErrors()
+	Validate() error
 	FindMatchingRoute(request HTTPRequest) (*node, error)
-	Group(url string, router func(router Router))
+	FindFallbackRoute(request HTTPRequest) *node
+	AllowedMethods(url string) []Request
+	NotFound(handler func(writer HTTPWriter, request HTTPRequest))
+	MethodNotAllowed(handler func(writer HTTPWriter, request HTTPRequest))
+	SetLogger(logger *slog.Logger)
+	Group(url string, routes ...func(router Router)) Router
+	Route(url string, register func(router Router)) Router
+	Mount(url string, handler http.Handler)
+	ServeHTTP(w http.ResponseWriter, req *http.Request)
 	Use(middlewareFunc func(writer HTTPWriter, request HTTPRequest, next func()))
-	add(route)
+	add(route) *route
 }
 
 type route struct {
@@ -21,182 +42,463 @@ type route struct {
 	Method  Request
 	Handler func(writer HTTPWriter, request HTTPRequest)
 	Request HTTPRequest
+	Name    string
+	params  []routeParam // in the order they appear in Url
 }
 
 type router struct {
 	currentNode *node
+	registry    *registry // shared by the router and all of its groups
+	prefix      string    // prepended to urls registered through a group
+}
+
+// registry holds the routes of a router and its groups, along with what went wrong registering them.
+type registry struct {
+	routes        *tree
+	names         map[string]*route
+	fallbacks     []*router // groups with their own NotFound or MethodNotAllowed handler
+	logger        *slog.Logger
+	collectErrors bool
+	errs          []error
 }
 
 type node struct {
-	parent      *node
-	children    []node
-	path        string
-	Route       *route
-	middlewares []MiddlewareFunc
+	parent           *node
+	children         []*node
+	path             string
+	Route            *route
+	middlewares      []MiddlewareFunc
+	notFound         func(writer HTTPWriter, request HTTPRequest) // nil to use the one of the parent
+	methodNotAllowed func(writer HTTPWriter, request HTTPRequest)
 }
 
 func NewRouter() Router {
 	nde := node{
-		path: "/", // Initial route
+		path:             "/", // Initial route
+		notFound:         defaultNotFound,
+		methodNotAllowed: defaultMethodNotAllowed,
 	}
 	return &router{
 		currentNode: &nde,
+		registry: &registry{
+			routes: newTree(),
+			names:  make(map[string]*route),
+			logger: slog.Default(),
+		},
 	}
 }
 
-func (r *router) add(route route) {
-	if len(route.Url) == 0 {
-		panic(fmt.Sprintf("route must not be an empty string"))
-	}
-
-	if string(route.Url[len(route.Url)-1]) == "/" {
-		panic(fmt.Sprintf("failed adding route, shouldn't end with a /"))
+// add registers route, reporting a malformed, duplicate or ambiguous url through fail, in which case it returns nil.
+func (r *router) add(route route) *route {
+	if err := validateUrl(route.Url); err != nil {
+		r.fail(err)
+		return nil
 	}
 
-	if string(route.Url[0]) != "/" {
-		panic(fmt.Sprintf("failed adding route, should start with a /"))
+	route.Url = r.prefix + route.Url
+	params, err := parsePattern(route.Url)
+	if err != nil {
+		r.fail(err)
+		return nil
 	}
+	route.params = params
 
-	nde := node{
+	err = r.registry.routes.insert(route.Method, route.Url, route.params, &node{
 		parent: r.currentNode,
 		path:   route.Url,
 		Route:  &route,
+	})
+	if err != nil {
+		r.fail(err)
+		return nil
 	}
 
-	r.currentNode.children = append(r.currentNode.children, nde)
+	return &route
 }
 
-func compareRoutes(requestUrl, routerUrl string) bool {
-	requestUrlParts := strings.Split(requestUrl, "/")
-	routerUrlParts := strings.Split(routerUrl, "/")
+func validateUrl(url string) error {
+	if len(url) == 0 {
+		return fmt.Errorf("route must not be an empty string")
+	}
 
-	if routerUrl == "/" {
-		routerUrlParts = []string{""}
+	if string(url[len(url)-1]) == "/" {
+		return fmt.Errorf("failed adding route %s, shouldn't end with a /", url)
 	}
 
-	if requestUrl == "/" {
-		requestUrlParts = []string{""}
+	if string(url[0]) != "/" {
+		return fmt.Errorf("failed adding route %s, should start with a /", url)
 	}
 
-	if len(requestUrlParts) != len(routerUrlParts) {
-		return false
+	return nil
+}
+
+// fail reports a registration error. It panics, unless CollectErrors was called, then Validate returns it.
+func (r *router) fail(err error) {
+	if !r.registry.collectErrors {
+		panic(err)
 	}
 
-	for i, part := range routerUrlParts {
-		if part == "" {
-			continue
-		}
+	r.registry.errs = append(r.registry.errs, err)
+}
 
-		isDynamic := string(part[0]) == ":"
-		if isDynamic {
-			continue
+// CollectErrors makes the router and its groups collect registration errors, such as malformed, duplicate
+// or ambiguous routes, instead of panicking on the first one. Call Validate once all routes are registered.
+func (r *router) CollectErrors() {
+	r.registry.collectErrors = true
+}
+
+// Validate returns every registration error collected since CollectErrors, joined into one.
+func (r *router) Validate() error {
+	return errors.Join(r.registry.errs...)
+}
+
+// FindMatchingRoute returns the route registered for the request's method and url, and hands the
+// request the url params matched along the way. Without an explicit route, HEAD requests get the GET
+// route, the writer drops the body, and OPTIONS requests get an automatic response listing the allowed methods.
+func (r *router) FindMatchingRoute(request HTTPRequest) (*node, error) {
+	n, params := r.registry.routes.lookup(request.Method(), request.Url())
+	if n == nil && request.Method() == Head {
+		n, params = r.registry.routes.lookup(Get, request.Url())
+	}
+
+	if n == nil && request.Method() == Options {
+		n = r.automaticOptions(request.Url())
+	}
+
+	if n == nil {
+		return nil, fmt.Errorf("could not find match for request URL: %s", request.Url())
+	}
+	request.SetURLParams(params)
+	return n, nil
+}
+
+// automaticOptions answers OPTIONS with a 204 and an Allow header. The route shares the parent of the
+// first route matching url, so the middlewares of its group, e.g. CORS, still run.
+func (r *router) automaticOptions(url string) *node {
+	matches := r.registry.routes.matches(url)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	allow := joinMethods(r.AllowedMethods(url))
+	return &node{
+		parent: matches[0].parent,
+		path:   url,
+		Route: &route{
+			Url:    matches[0].Route.Url,
+			Method: Options,
+			Handler: func(writer HTTPWriter, request HTTPRequest) {
+				writer.Header().Set(Allow, allow)
+				writer.Response("", 204)
+			},
+		},
+	}
+}
+
+// FindFallbackRoute returns the route answering a request FindMatchingRoute couldn't match: the
+// MethodNotAllowed handler when the url is registered under other methods, otherwise the NotFound handler.
+// The route hangs off the router's own node so its middlewares still run.
+func (r *router) FindFallbackRoute(request HTTPRequest) *node {
+	allowed := r.AllowedMethods(request.Url())
+	r.registry.logger.Debug("no route matched",
+		"method", string(request.Method()),
+		"path", request.Url(),
+		"allowed_methods", allowed,
+	)
+
+	scope := r.fallbackScope(request.Url())
+	for scope.notFound == nil {
+		scope = scope.parent
+	}
+	handler := scope.notFound
+	if len(allowed) > 0 {
+		for scope = r.fallbackScope(request.Url()); scope.methodNotAllowed == nil; {
+			scope = scope.parent
+		}
+		allow, methodNotAllowed := joinMethods(allowed), scope.methodNotAllowed
+		handler = func(writer HTTPWriter, request HTTPRequest) {
+			writer.Header().Add(Allow, allow)
+			methodNotAllowed(writer, request)
 		}
+	}
 
-		if part != requestUrlParts[i] {
-			return false
+	return &node{
+		parent: scope,
+		path:   request.Url(),
+		Route: &route{
+			Url:     request.Url(),
+			Method:  request.Method(),
+			Handler: handler,
+		},
+	}
+}
+
+// AllowedMethods lists the methods with a route matching url, sorted alphabetically. HEAD is included when
+// GET is, and OPTIONS whenever any route matches, since FindMatchingRoute answers those automatically.
+func (r *router) AllowedMethods(url string) []Request {
+	var methods []Request
+	for _, match := range r.registry.routes.matches(url) {
+		if !slices.Contains(methods, match.Route.Method) {
+			methods = append(methods, match.Route.Method)
 		}
 	}
 
-	return true
+	if slices.Contains(methods, Get) && !slices.Contains(methods, Head) {
+		methods = append(methods, Head)
+	}
+
+	if len(methods) > 0 && !slices.Contains(methods, Options) {
+		methods = append(methods, Options)
+	}
+	slices.Sort(methods)
+
+	return methods
 }
 
-func findMatchingNode(requestUrl string, method Request, n *node) *node {
-	isRoot := n.path == "/"
-	if compareRoutes(requestUrl, n.path) && n.Route.Method == method {
-		return n
+func joinMethods(methods []Request) string {
+	var parts []string
+	for _, method := range methods {
+		parts = append(parts, string(method))
 	}
 
-	var requestUrlsParts []string
-	urlParts := strings.Split(requestUrl, "/")
-	for i, part := range urlParts {
-		if isRoot && i != 0 {
-			requestUrlsParts = append(requestUrlsParts, "/"+part)
-		} else if i != 0 && i != 1 { // removes current entry + leading /
-			requestUrlsParts = append(requestUrlsParts, "/"+part)
+	return strings.Join(parts, ", ")
+}
+
+// NotFound replaces the handler answering requests for urls without any route. On a group it only answers
+// urls under the group's prefix, running after the group's middlewares.
+func (r *router) NotFound(handler func(writer HTTPWriter, request HTTPRequest)) {
+	r.currentNode.notFound = handler
+	r.addFallback()
+}
+
+// MethodNotAllowed replaces the handler answering requests for urls that only have routes for other methods.
+// The Allow header is already set when it runs. On a group it only answers urls under the group's prefix.
+func (r *router) MethodNotAllowed(handler func(writer HTTPWriter, request HTTPRequest)) {
+	r.currentNode.methodNotAllowed = handler
+	r.addFallback()
+}
+
+func (r *router) addFallback() {
+	if r.currentNode.parent != nil && !slices.ContainsFunc(r.registry.fallbacks, func(group *router) bool {
+		return group.currentNode == r.currentNode
+	}) {
+		r.registry.fallbacks = append(r.registry.fallbacks, r)
+	}
+}
+
+// fallbackScope returns the scope of the innermost group with its own fallback handlers whose prefix url is
+// under, or the root scope when there's none. Its handlers, or those of its parents, answer the request.
+func (r *router) fallbackScope(url string) *node {
+	scope := r.currentNode
+	for scope.parent != nil {
+		scope = scope.parent
+	}
+
+	depth := -1
+	for _, group := range r.registry.fallbacks {
+		segments := len(splitSegments(group.prefix))
+		if segments > depth && underPrefix(group.prefix, url) {
+			scope, depth = group.currentNode, segments
 		}
 	}
 
-	// Check again on current path
-	var result *node
-	for _, child := range n.children {
-		if compareRoutes(requestUrl, child.path) && child.Route.Method == method {
-			result = &child
-		} else if child.path == requestUrlsParts[0] {
-			result = findMatchingNode(strings.Join(requestUrlsParts, ""), method, &child)
+	return scope
+}
+
+// underPrefix reports whether url falls under the group prefix, whose params match any segment that fits
+// their constraint.
+func underPrefix(prefix, url string) bool {
+	prefixSegments, segments := splitSegments(prefix), strings.Split(url, "/")
+	if len(segments) < len(prefixSegments) {
+		return false
+	}
+
+	for i, segment := range prefixSegments {
+		if !isDynamic(segment) {
+			if segment != segments[i] {
+				return false
+			}
+			continue
 		}
 
-		if result != nil {
-			return result
+		param, err := parseParam(segment)
+		switch {
+		case err != nil:
+			return false
+		case param.wildcard:
+			return true
+		case segments[i] == "" || param.constraint != nil && !param.constraint.MatchString(segments[i]):
+			return false
 		}
 	}
 
-	return nil
+	return true
 }
 
-func (r *router) FindMatchingRoute(request HTTPRequest) (*node, error) {
-	n := findMatchingNode(request.Url(), request.Method(), r.currentNode)
-	if n == nil {
-		return nil, fmt.Errorf("could not find match for request URL: %s", request.Url())
-	}
-	return n, nil
+// SetLogger replaces the logger, slog.Default() unless set, that receives the router's diagnostics.
+// The router and its groups share one logger.
+func (r *router) SetLogger(logger *slog.Logger) {
+	r.registry.logger = logger
+}
+
+func defaultNotFound(writer HTTPWriter, request HTTPRequest) {
+	writer.Header().Add(ContentType, "text/plain; charset=utf-8")
+	writer.Response(getStatusMessage(404), 404)
+}
+
+func defaultMethodNotAllowed(writer HTTPWriter, request HTTPRequest) {
+	writer.Header().Add(ContentType, "text/plain; charset=utf-8")
+	writer.Response(getStatusMessage(405), 405)
 }
 
-func (r *router) Group(url string, handler func(router Router)) {
-	var groupUrl = url
-	if r.currentNode.path == "/" {
-		groupUrl = url
+// Group returns a router for routes under url, sharing the routes of r. Middlewares added to it with Use
+// only run for its own routes and those of its groups, after the middlewares of r, whether they were added
+// before or after the routes. It can be used chained, api := r.Group("/api"), or with callbacks that get the group.
+func (r *router) Group(url string, routes ...func(router Router)) Router {
+	if err := validateUrl(url); err != nil {
+		r.fail(fmt.Errorf("failed adding group: %w", err))
 	}
 
-	nde := node{
-		parent:   r.currentNode,
-		path:     groupUrl,
-		children: []node{},
+	nde := &node{
+		parent: r.currentNode,
+		path:   url,
+	}
+	r.currentNode.children = append(r.currentNode.children, nde)
+
+	rter := &router{
+		currentNode: nde,
+		registry:    r.registry,
+		prefix:      r.prefix + url,
 	}
 
-	rter := router{
-		currentNode: &nde,
+	for _, register := range routes {
+		register(rter)
 	}
 
-	handler(&rter)
-	r.currentNode.children = append(r.currentNode.children, nde)
+	return rter
 }
 
-func (r *router) Delete(url string, handler func(writer HTTPWriter, request HTTPRequest)) {
-	newRoute := route{
-		Url:     url,
-		Handler: handler,
-		Method:  Delete,
+// Route is Group with exactly one callback, for when the nesting should show in the code.
+func (r *router) Route(url string, register func(router Router)) Router {
+	return r.Group(url, register)
+}
+
+// Mount serves handler under url. A router built with NewRouter has its routes added, they run through the
+// middlewares of r first and then their own ones. A group brings only its own routes, without its prefix, and
+// the middlewares from the group down. Mount copies what the router has at that point, routes or middlewares
+// added to it later aren't picked up. Route names come along, unless r already has a route by that name, e.g.
+// when the same router is mounted twice the first mount keeps it. Any other http.Handler gets every request
+// under url for any method, with url stripped from the path like http.StripPrefix does, so url and the prefix
+// of r can't hold params for it.
+func (r *router) Mount(url string, handler http.Handler) {
+	if handler == nil {
+		r.fail(fmt.Errorf("failed mounting %s, handler is nil", url))
+		return
 	}
 
-	r.add(newRoute)
-}
+	mounted, ok := handler.(*router)
+	if !ok {
+		// StripPrefix only knows the literal prefix, it would never match a path with a value in place of a param
+		if slices.ContainsFunc(splitSegments(r.prefix+url), isDynamic) {
+			r.fail(fmt.Errorf("failed mounting %s, a net/http handler can't be mounted under a param or wildcard", r.prefix+url))
+			return
+		}
+		serve := FromHTTPHandler(http.StripPrefix(r.prefix+url, handler))
+		r.Any(url, serve)
+		r.Any(url+"/*path", serve)
+		return
+	}
+	group := r.Group(url).(*router)
+
+	// Copy the scopes of sub so their middlewares hang off the group, leaving sub itself untouched
+	scopes := map[*node]*node{mounted.currentNode: {parent: group.currentNode, path: "/", middlewares: slices.Clone(mounted.currentNode.middlewares)}}
+	var copyScope func(n *node) *node
+	copyScope = func(n *node) *node {
+		if scope, exists := scopes[n]; exists {
+			return scope
+		}
 
-func (r *router) Put(url string, handler func(writer HTTPWriter, request HTTPRequest)) {
-	newRoute := route{
-		Url:     url,
-		Handler: handler,
-		Method:  Put,
+		scope := &node{parent: copyScope(n.parent), path: n.path, middlewares: slices.Clone(n.middlewares)}
+		scope.parent.children = append(scope.parent.children, scope)
+		scopes[n] = scope
+		return scope
 	}
+	group.currentNode.children = append(group.currentNode.children, scopes[mounted.currentNode])
 
-	r.add(newRoute)
+	var nodes []*node
+	mounted.registry.routes.walk(func(n *node) {
+		// A group shares its registry with the rest of its router, only its own routes come along
+		if hasAncestor(n, mounted.currentNode) {
+			nodes = append(nodes, n)
+		}
+	})
+	for _, n := range nodes {
+		scope := &router{currentNode: copyScope(n.parent), registry: r.registry, prefix: group.prefix}
+		url := strings.TrimPrefix(n.Route.Url, mounted.prefix)
+		added := scope.add(route{Url: url, Method: n.Route.Method, Handler: n.Route.Handler})
+		if _, taken := r.registry.names[n.Route.Name]; added != nil && n.Route.Name != "" && !taken {
+			(&routeBuilder{router: r, routes: []*route{added}}).Name(n.Route.Name)
+		}
+	}
 }
 
-func (r *router) Post(url string, handler func(writer HTTPWriter, request HTTPRequest)) {
+// Handle registers handler for requests to url using method, which can be any method, e.g. WebDAV's PROPFIND.
+func (r *router) Handle(method Request, url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder {
+	if method == "" {
+		r.fail(fmt.Errorf("failed adding route %s, method must not be empty", url))
+		return &routeBuilder{router: r}
+	}
+
 	newRoute := route{
 		Url:     url,
 		Handler: handler,
-		Method:  Post,
+		Method:  method,
+	}
+
+	builder := &routeBuilder{router: r}
+	if added := r.add(newRoute); added != nil {
+		builder.routes = append(builder.routes, added)
 	}
 
-	r.add(newRoute)
+	return builder
 }
 
-func (r *router) Get(url string, handler func(writer HTTPWriter, request HTTPRequest)) {
-	newRoute := route{
-		Url:     url,
-		Handler: handler,
-		Method:  Get,
+// Any registers handler for url under every method in Methods.
+func (r *router) Any(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder {
+	builder := &routeBuilder{router: r}
+	for _, method := range Methods {
+		if added := r.add(route{Url: url, Handler: handler, Method: method}); added != nil {
+			builder.routes = append(builder.routes, added)
+		}
 	}
 
-	r.add(newRoute)
+	return builder
+}
+
+func (r *router) Options(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder {
+	return r.Handle(Options, url, handler)
+}
+
+func (r *router) Head(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder {
+	return r.Handle(Head, url, handler)
+}
+
+func (r *router) Patch(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder {
+	return r.Handle(Patch, url, handler)
+}
+
+func (r *router) Delete(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder {
+	return r.Handle(Delete, url, handler)
+}
+
+func (r *router) Put(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder {
+	return r.Handle(Put, url, handler)
+}
+
+func (r *router) Post(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder {
+	return r.Handle(Post, url, handler)
+}
+
+func (r *router) Get(url string, handler func(writer HTTPWriter, request HTTPRequest)) RouteBuilder {
+	return r.Handle(Get, url, handler)
 }
@@ -1,6 +1,9 @@
 package router
 
 import (
+	"log/slog"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -22,7 +25,7 @@ func Test_router_FindMatchingRoute(t *testing.T) {
 			name: "exact match static route",
 			request: httpRequest{
 				startLine: "GET /url HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
 				url:       "/url",
@@ -35,7 +38,7 @@ func Test_router_FindMatchingRoute(t *testing.T) {
 			name: "dynamic parameter match",
 			request: httpRequest{
 				startLine: "GET /url/123 HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
 				url:       "/url/123",
@@ -48,7 +51,7 @@ func Test_router_FindMatchingRoute(t *testing.T) {
 			name: "static POST route",
 			request: httpRequest{
 				startLine: "POST /users/example HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com", "Content-Type": "application/json"},
+				headers:   Headers{"Host": {"example.com"}, "Content-Type": {"application/json"}},
 				body:      `{"name":"test"}`,
 				params:    nil,
 				url:       "/users/example",
@@ -61,7 +64,7 @@ func Test_router_FindMatchingRoute(t *testing.T) {
 			name: "static PUT route",
 			request: httpRequest{
 				startLine: "PUT /user HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
 				url:       "/user",
@@ -74,7 +77,7 @@ func Test_router_FindMatchingRoute(t *testing.T) {
 			name: "multiple dynamic parameters",
 			request: httpRequest{
 				startLine: "GET /posts/42/comments/789 HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
 				url:       "/posts/42/comments/789",
@@ -87,7 +90,7 @@ func Test_router_FindMatchingRoute(t *testing.T) {
 			name: "DELETE route with dynamic parameter",
 			request: httpRequest{
 				startLine: "DELETE /items/999 HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
 				url:       "/items/999",
@@ -100,7 +103,7 @@ func Test_router_FindMatchingRoute(t *testing.T) {
 			name: "nonexistent route returns nil",
 			request: httpRequest{
 				startLine: "GET /nonexistent HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
 				url:       "/nonexistent",
@@ -113,7 +116,7 @@ func Test_router_FindMatchingRoute(t *testing.T) {
 			name: "wrong method returns nil",
 			request: httpRequest{
 				startLine: "POST /url/123 HTTP/1.1",
-				headers:   map[string]string{"Host": "example.com"},
+				headers:   Headers{"Host": {"example.com"}},
 				body:      "",
 				params:    nil,
 				url:       "/url/123",
@@ -223,111 +226,566 @@ func assertNoPanic(t *testing.T, f func()) {
 	f()
 }
 
-func TestCompareRoutes(t *testing.T) {
+func Test_router_AllowedMethods(t *testing.T) {
+	r := NewRouter()
+	r.Get("/users", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Post("/users", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Delete("/users/:id", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Put("/users/:id", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Group("/api", func(router Router) {
+		router.Get("/status", func(writer HTTPWriter, request HTTPRequest) {})
+	})
+
 	tests := []struct {
-		name       string
-		requestUrl string
-		routerUrl  string
-		expected   bool
+		url             string
+		expectedMethods []Request
+	}{
+		{url: "/users", expectedMethods: []Request{Get, Head, Options, Post}},
+		{url: "/users/42", expectedMethods: []Request{Delete, Options, Put}},
+		{url: "/api/status", expectedMethods: []Request{Get, Head, Options}},
+		{url: "/api", expectedMethods: nil},
+		{url: "/", expectedMethods: nil},
+		{url: "/nonexistent", expectedMethods: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			methods := r.AllowedMethods(tt.url)
+			if !slices.Equal(methods, tt.expectedMethods) {
+				t.Errorf("expected methods %v but got %v", tt.expectedMethods, methods)
+			}
+		})
+	}
+}
+
+func Test_router_Methods(t *testing.T) {
+	r := NewRouter()
+	r.Patch("/users/:id", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Head("/users/:id", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Options("/users", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Handle("PROPFIND", "/files", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Any("/echo", func(writer HTTPWriter, request HTTPRequest) {})
+
+	tests := []struct {
+		method      Request
+		url         string
+		expectMatch bool
+	}{
+		{method: Patch, url: "/users/1", expectMatch: true},
+		{method: Head, url: "/users/1", expectMatch: true},
+		{method: Options, url: "/users", expectMatch: true},
+		{method: "PROPFIND", url: "/files", expectMatch: true},
+		{method: Get, url: "/files", expectMatch: false},
+		{method: Get, url: "/echo", expectMatch: true},
+		{method: Delete, url: "/echo", expectMatch: true},
+		{method: Patch, url: "/echo", expectMatch: true},
+		{method: "PROPFIND", url: "/echo", expectMatch: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.method)+" "+tt.url, func(t *testing.T) {
+			n, err := r.FindMatchingRoute(&httpRequest{url: tt.url, method: tt.method})
+			if tt.expectMatch && (err != nil || n.Route.Method != tt.method) {
+				t.Errorf("expected a %s route for %s but got %v", tt.method, tt.url, err)
+			}
+
+			if !tt.expectMatch && err == nil {
+				t.Errorf("expected no %s route for %s", tt.method, tt.url)
+			}
+		})
+	}
+
+	assertPanic(t, func() { r.Handle("", "/empty", func(writer HTTPWriter, request HTTPRequest) {}) })
+}
+
+func Test_router_FindFallbackRoute(t *testing.T) {
+	tests := []struct {
+		name          string
+		request       httpRequest
+		setup         func(r Router)
+		expectedWrite string
 	}{
-		// Exact matches
-		{
-			name:       "exact match",
-			requestUrl: "/users/profile",
-			routerUrl:  "/users/profile",
-			expected:   true,
-		},
-		{
-			name:       "exact match single segment",
-			requestUrl: "/users",
-			routerUrl:  "/users",
-			expected:   true,
-		},
-		// Dynamic parameters
-		{
-			name:       "dynamic parameter match",
-			requestUrl: "/users/123",
-			routerUrl:  "/users/:id",
-			expected:   true,
-		},
 		{
-			name:       "multiple dynamic parameters",
-			requestUrl: "/users/123/posts/456",
-			routerUrl:  "/users/:userId/posts/:postId",
-			expected:   true,
+			name:          "default not found",
+			request:       httpRequest{url: "/nonexistent", method: Get},
+			expectedWrite: "HTTP/1.1 404 Not Found\r\nContent-Length: 9\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nNot Found",
 		},
 		{
-			name:       "mixed static and dynamic",
-			requestUrl: "/api/users/john/profile",
-			routerUrl:  "/api/users/:name/profile",
-			expected:   true,
+			name:          "default method not allowed",
+			request:       httpRequest{url: "/users", method: Delete},
+			expectedWrite: "HTTP/1.1 405 Method Not Allowed\r\nContent-Length: 18\r\nAllow: GET, HEAD, OPTIONS, POST\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nMethod Not Allowed",
 		},
-		// Length mismatches
 		{
-			name:       "different number of segments",
-			requestUrl: "/users/123",
-			routerUrl:  "/users/123/posts",
-			expected:   false,
+			name:    "custom not found",
+			request: httpRequest{url: "/nonexistent", method: Get},
+			setup: func(r Router) {
+				r.NotFound(func(writer HTTPWriter, request HTTPRequest) {
+					writer.Response(`{"error":"not found"}`, 404)
+				})
+			},
+			expectedWrite: "HTTP/1.1 404 Not Found\r\nContent-Length: 21\r\n\r\n{\"error\":\"not found\"}",
 		},
 		{
-			name:       "request has fewer segments",
-			requestUrl: "/users",
-			routerUrl:  "/users/123/posts",
-			expected:   false,
+			name:    "custom method not allowed keeps the allow header",
+			request: httpRequest{url: "/users", method: Put},
+			setup: func(r Router) {
+				r.MethodNotAllowed(func(writer HTTPWriter, request HTTPRequest) {
+					writer.Response("", 405)
+				})
+			},
+			expectedWrite: "HTTP/1.1 405 Method Not Allowed\r\nAllow: GET, HEAD, OPTIONS, POST\r\n\r\n",
 		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter()
+			r.Get("/users", func(writer HTTPWriter, request HTTPRequest) {})
+			r.Post("/users", func(writer HTTPWriter, request HTTPRequest) {})
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+
+			routerNode := r.FindFallbackRoute(&tt.request)
+			mockConn := &mockConnection{}
+			writer := NewHTTPWriter(mockConn, tt.request.method)
+			handler := ApplyMiddlewares(writer, &tt.request, GetMiddlewares(routerNode), routerNode.Route.Handler)
+			handler()
+
+			if string(mockConn.written) != tt.expectedWrite {
+				t.Errorf("expected write to be %q but got %q", tt.expectedWrite, mockConn.written)
+			}
+		})
+	}
+}
+
+func Test_router_Validate(t *testing.T) {
+	handler := func(writer HTTPWriter, request HTTPRequest) {}
+
+	t.Run("valid routes", func(t *testing.T) {
+		r := NewRouter()
+		r.CollectErrors()
+		r.Get("/users/:id", handler)
+		r.Put("/users/:id", handler)
+		r.Get("/users/:id/posts", handler)
+		r.Get("/users/:id<int>/avatar", handler)
+		r.Get("/users/new", handler)
+		r.Get("/files/*path", handler)
+
+		if err := r.Validate(); err != nil {
+			t.Errorf("expected no errors but got %s", err)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		register func(r Router)
+	}{
 		{
-			name:       "router has fewer segments",
-			requestUrl: "/users/123/posts",
-			routerUrl:  "/users/123",
-			expected:   false,
+			name: "duplicate route",
+			register: func(r Router) {
+				r.Get("/users/:id", handler)
+				r.Get("/users/:id", handler)
+			},
 		},
-		// Static mismatch
 		{
-			name:       "static segments don't match",
-			requestUrl: "/users/123",
-			routerUrl:  "/posts/123",
-			expected:   false,
+			name: "duplicate through a group",
+			register: func(r Router) {
+				r.Get("/api/status", handler)
+				r.Group("/api", func(api Router) {
+					api.Get("/status", handler)
+				})
+			},
 		},
 		{
-			name:       "different static segment in middle",
-			requestUrl: "/api/users/123/profile",
-			routerUrl:  "/api/posts/123/profile",
-			expected:   false,
+			name: "ambiguous param names",
+			register: func(r Router) {
+				r.Get("/users/:id", handler)
+				r.Get("/users/:name", handler)
+			},
 		},
-		// Edge cases
 		{
-			name:       "all dynamic parameters",
-			requestUrl: "/a/b/c",
-			routerUrl:  "/:x/:y/:z",
-			expected:   true,
+			name: "param names differing across methods",
+			register: func(r Router) {
+				r.Get("/users/:id", handler)
+				r.Delete("/users/:userId/posts", handler)
+			},
 		},
 		{
-			name:       "all static segments",
-			requestUrl: "/users/profile/settings",
-			routerUrl:  "/users/profile/settings",
-			expected:   true,
+			name: "ambiguous wildcard names",
+			register: func(r Router) {
+				r.Get("/files/*path", handler)
+				r.Post("/files/*name", handler)
+			},
 		},
 		{
-			name:       "empty paths",
-			requestUrl: "/",
-			routerUrl:  "/",
-			expected:   true,
+			name: "malformed url",
+			register: func(r Router) {
+				r.Get("/users/", handler)
+			},
 		},
 		{
-			name:       "single character dynamic parameter",
-			requestUrl: "/a",
-			routerUrl:  "/:id",
-			expected:   true,
+			name: "duplicate name",
+			register: func(r Router) {
+				r.Get("/users", handler).Name("users")
+				r.Post("/users", handler).Name("users")
+			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := compareRoutes(tt.requestUrl, tt.routerUrl)
-			if result != tt.expected {
-				t.Errorf("compareRoutes(%q, %q) = %v, want %v",
-					tt.requestUrl, tt.routerUrl, result, tt.expected)
+			r := NewRouter()
+			r.CollectErrors()
+			assertNoPanic(t, func() { tt.register(r) })
+			if err := r.Validate(); err == nil {
+				t.Errorf("expected Validate to report an error")
+			}
+
+			assertPanic(t, func() { tt.register(NewRouter()) })
+		})
+	}
+
+	t.Run("errors are collected", func(t *testing.T) {
+		r := NewRouter()
+		r.CollectErrors()
+		r.Get("", handler)
+		r.Get("/users", handler)
+		r.Get("/users", handler)
+		r.Handle("", "/users", handler)
+
+		err := r.Validate()
+		if err == nil || len(strings.Split(err.Error(), "\n")) != 3 {
+			t.Errorf("expected three errors but got %v", err)
+		}
+
+		// The first registration still serves requests
+		if _, err := r.FindMatchingRoute(&httpRequest{url: "/users", method: Get}); err != nil {
+			t.Errorf("expected GET /users to match but got %s", err)
+		}
+	})
+}
+
+// serveTrace runs the route matching method and url and returns the names its middlewares and handler recorded.
+func serveTrace(t *testing.T, r Router, method Request, url string, trace *[]string) []string {
+	t.Helper()
+	*trace = nil
+	request := &httpRequest{url: url, method: method}
+	n, err := r.FindMatchingRoute(request)
+	if err != nil {
+		t.Fatalf("expected %s %s to match but got %s", method, url, err)
+	}
+
+	writer := NewHTTPWriter(&mockConnection{}, method)
+	ApplyMiddlewares(writer, request, GetMiddlewares(n), n.Route.Handler)()
+	return *trace
+}
+
+func Test_router_Group(t *testing.T) {
+	var trace []string
+	record := func(name string) MiddlewareFunc {
+		return func(writer HTTPWriter, request HTTPRequest, next func()) {
+			trace = append(trace, name)
+			next()
+		}
+	}
+	handler := func(name string) func(writer HTTPWriter, request HTTPRequest) {
+		return func(writer HTTPWriter, request HTTPRequest) {
+			trace = append(trace, name)
+		}
+	}
+
+	r := NewRouter()
+	r.Use(record("root"))
+	r.Get("/health", handler("health"))
+
+	api := r.Group("/api")
+	api.Use(record("api"))
+	api.Get("/status", handler("status"))
+
+	v1 := api.Group("/v1", func(v1 Router) {
+		v1.Get("/users/:id", handler("user"))
+		v1.Route("/admin", func(admin Router) {
+			admin.Get("/stats", handler("stats"))
+			admin.Use(record("admin"))
+		})
+	})
+	// Added after the routes and outside the callback, still applies to the whole group
+	v1.Use(record("v1"))
+	v1.Use(record("v1.second"))
+
+	api.Group("/v2", func(v2 Router) {
+		v2.Use(record("v2"))
+		v2.Get("/users/:id", handler("user.v2"))
+	})
+	r.Use(record("root.late"))
+
+	tests := []struct {
+		url           string
+		expectedTrace []string
+	}{
+		{url: "/health", expectedTrace: []string{"root", "root.late", "health"}},
+		{url: "/api/status", expectedTrace: []string{"root", "root.late", "api", "status"}},
+		{url: "/api/v1/users/1", expectedTrace: []string{"root", "root.late", "api", "v1", "v1.second", "user"}},
+		{url: "/api/v1/admin/stats", expectedTrace: []string{"root", "root.late", "api", "v1", "v1.second", "admin", "stats"}},
+		{url: "/api/v2/users/1", expectedTrace: []string{"root", "root.late", "api", "v2", "user.v2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got := serveTrace(t, r, Get, tt.url, &trace)
+			if !slices.Equal(got, tt.expectedTrace) {
+				t.Errorf("expected %v but got %v", tt.expectedTrace, got)
+			}
+		})
+	}
+
+	t.Run("invalid group url", func(t *testing.T) {
+		assertPanic(t, func() { NewRouter().Group("api/") })
+	})
+}
+
+func Test_router_Mount(t *testing.T) {
+	var trace []string
+	record := func(name string) MiddlewareFunc {
+		return func(writer HTTPWriter, request HTTPRequest, next func()) {
+			trace = append(trace, name)
+			next()
+		}
+	}
+	handler := func(name string) func(writer HTTPWriter, request HTTPRequest) {
+		return func(writer HTTPWriter, request HTTPRequest) {
+			trace = append(trace, name)
+		}
+	}
+
+	users := NewRouter()
+	users.Use(record("users"))
+	users.Get("/:id", handler("user")).Name("user.show")
+	users.Group("/:id/posts", func(posts Router) {
+		posts.Use(record("posts"))
+		posts.Get("/:post", handler("post"))
+	})
+
+	r := NewRouter()
+	r.Use(record("root"))
+	r.Group("/api", func(api Router) {
+		api.Use(record("api"))
+		api.Mount("/users", users)
+	})
+	users.Get("/late", handler("late"))
+
+	tests := []struct {
+		url           string
+		expectedTrace []string
+	}{
+		{url: "/api/users/7", expectedTrace: []string{"root", "api", "users", "user"}},
+		{url: "/api/users/7/posts/3", expectedTrace: []string{"root", "api", "users", "posts", "post"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got := serveTrace(t, r, Get, tt.url, &trace)
+			if !slices.Equal(got, tt.expectedTrace) {
+				t.Errorf("expected %v but got %v", tt.expectedTrace, got)
+			}
+		})
+	}
+
+	t.Run("sub router is left alone", func(t *testing.T) {
+		got := serveTrace(t, users, Get, "/7", &trace)
+		if !slices.Equal(got, []string{"users", "user"}) {
+			t.Errorf("expected the sub router to keep its own middlewares but got %v", got)
+		}
+	})
+
+	t.Run("names come along", func(t *testing.T) {
+		url, err := r.URL("user.show", "id", "7")
+		if err != nil || url != "/api/users/7" {
+			t.Errorf("expected /api/users/7 but got %s, %v", url, err)
+		}
+	})
+
+	t.Run("later routes aren't mounted", func(t *testing.T) {
+		if n, err := r.FindMatchingRoute(&httpRequest{url: "/api/users/late", method: Get}); err == nil && n.Route.Url != "/api/users/:id" {
+			t.Errorf("expected /api/users/late to not be mounted but got %s", n.Route.Url)
+		}
+	})
+}
+
+func Test_router_GroupMiddlewaresDontShareSlices(t *testing.T) {
+	var trace []string
+	record := func(name string) MiddlewareFunc {
+		return func(writer HTTPWriter, request HTTPRequest, next func()) {
+			trace = append(trace, name)
+			next()
+		}
+	}
+	handler := func(writer HTTPWriter, request HTTPRequest) {}
+
+	r := NewRouter()
+	// Three root middlewares leave spare capacity for an append to write into
+	r.Use(record("root1"))
+	r.Use(record("root2"))
+	r.Use(record("root3"))
+	a := r.Group("/a")
+	a.Use(record("a"))
+	a.Get("/x", handler)
+	b := r.Group("/b")
+	b.Use(record("b"))
+	b.Get("/x", handler)
+
+	nodeA, err := r.FindMatchingRoute(&httpRequest{url: "/a/x", method: Get})
+	if err != nil {
+		t.Fatalf("expected /a/x to match but got %s", err)
+	}
+	nodeB, err := r.FindMatchingRoute(&httpRequest{url: "/b/x", method: Get})
+	if err != nil {
+		t.Fatalf("expected /b/x to match but got %s", err)
+	}
+
+	// Build B's chain in between, like a request on another connection would
+	middlewaresA := GetMiddlewares(nodeA)
+	GetMiddlewares(nodeB)
+	ApplyMiddlewares(nil, &httpRequest{}, middlewaresA, handler)()
+
+	expected := []string{"root1", "root2", "root3", "a"}
+	if !slices.Equal(trace, expected) {
+		t.Errorf("expected %v but got %v", expected, trace)
+	}
+}
+
+func Test_router_GroupFallbacks(t *testing.T) {
+	respond := func(body string) func(writer HTTPWriter, request HTTPRequest) {
+		return func(writer HTTPWriter, request HTTPRequest) {
+			writer.Response(body, 404)
+		}
+	}
+	var trace []string
+	record := func(name string) MiddlewareFunc {
+		return func(writer HTTPWriter, request HTTPRequest, next func()) {
+			trace = append(trace, name)
+			next()
+		}
+	}
+
+	r := NewRouter()
+	r.Get("/home", func(writer HTTPWriter, request HTTPRequest) {})
+	api := r.Group("/api")
+	api.Use(record("api"))
+	api.NotFound(respond("api not found"))
+	api.MethodNotAllowed(func(writer HTTPWriter, request HTTPRequest) {
+		writer.Response("api method not allowed", 405)
+	})
+	api.Get("/users", func(writer HTTPWriter, request HTTPRequest) {})
+	api.Group("/v2", func(v2 Router) {
+		v2.NotFound(respond("v2 not found"))
+	})
+	r.Group("/tenants/:id<int>", func(tenant Router) {
+		tenant.NotFound(respond("tenant not found"))
+	})
+	r.Group("/silent").Get("/ping", func(writer HTTPWriter, request HTTPRequest) {})
+
+	tests := []struct {
+		method        Request
+		url           string
+		expectedBody  string
+		expectedTrace []string
+	}{
+		{method: Get, url: "/missing", expectedBody: "Not Found"},
+		{method: Get, url: "/apis", expectedBody: "Not Found"},
+		{method: Get, url: "/api/missing", expectedBody: "api not found", expectedTrace: []string{"api"}},
+		{method: Get, url: "/api", expectedBody: "api not found", expectedTrace: []string{"api"}},
+		{method: Post, url: "/api/users", expectedBody: "api method not allowed", expectedTrace: []string{"api"}},
+		{method: Get, url: "/api/v2/missing", expectedBody: "v2 not found", expectedTrace: []string{"api"}},
+		{method: Post, url: "/api/v2/missing", expectedBody: "v2 not found", expectedTrace: []string{"api"}},
+		{method: Get, url: "/tenants/7/missing", expectedBody: "tenant not found"},
+		{method: Get, url: "/tenants/acme/missing", expectedBody: "Not Found"},
+		{method: Get, url: "/silent/missing", expectedBody: "Not Found"},
+		{method: Post, url: "/home", expectedBody: "Method Not Allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.method)+" "+tt.url, func(t *testing.T) {
+			trace = nil
+			request := &httpRequest{url: tt.url, method: tt.method}
+			n := r.FindFallbackRoute(request)
+
+			conn := &mockConnection{}
+			ApplyMiddlewares(NewHTTPWriter(conn, tt.method), request, GetMiddlewares(n), n.Route.Handler)()
+			if !strings.HasSuffix(string(conn.written), "\r\n\r\n"+tt.expectedBody) {
+				t.Errorf("expected body %q but got %q", tt.expectedBody, conn.written)
+			}
+
+			if !slices.Equal(trace, tt.expectedTrace) {
+				t.Errorf("expected middlewares %v but got %v", tt.expectedTrace, trace)
 			}
 		})
 	}
 }
+
+func Test_router_MountTwice(t *testing.T) {
+	users := NewRouter()
+	users.Get("/:id", func(writer HTTPWriter, request HTTPRequest) {}).Name("user.show")
+
+	r := NewRouter()
+	r.Mount("/v1/users", users)
+	r.Mount("/v2/users", users)
+
+	for _, url := range []string{"/v1/users/7", "/v2/users/7"} {
+		if _, err := r.FindMatchingRoute(&httpRequest{url: url, method: Get}); err != nil {
+			t.Errorf("expected %s to match but got %s", url, err)
+		}
+	}
+
+	if url, err := r.URL("user.show", "id", "7"); err != nil || url != "/v1/users/7" {
+		t.Errorf("expected the first mount to keep the name but got %s, %v", url, err)
+	}
+}
+
+func Test_router_GroupSetLogger(t *testing.T) {
+	var logs strings.Builder
+	r := NewRouter()
+	r.Group("/api").SetLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	r.FindFallbackRoute(&httpRequest{url: "/missing", method: Get})
+	if !strings.Contains(logs.String(), "no route matched") {
+		t.Errorf("expected the logger set on a group to be used by the router but got %q", logs.String())
+	}
+}
+
+func Test_router_MountGroup(t *testing.T) {
+	var trace []string
+	record := func(name string) MiddlewareFunc {
+		return func(writer HTTPWriter, request HTTPRequest, next func()) {
+			trace = append(trace, name)
+			next()
+		}
+	}
+	handler := func(name string) func(writer HTTPWriter, request HTTPRequest) {
+		return func(writer HTTPWriter, request HTTPRequest) {
+			trace = append(trace, name)
+		}
+	}
+
+	source := NewRouter()
+	source.Use(record("source"))
+	source.Get("/outside", handler("outside"))
+	api := source.Group("/api")
+	api.Use(record("api"))
+	api.Get("/users/:id", handler("user"))
+
+	r := NewRouter()
+	assertNoPanic(t, func() { r.Mount("/m", api) })
+
+	got := serveTrace(t, r, Get, "/m/users/7", &trace)
+	if expected := []string{"api", "user"}; !slices.Equal(got, expected) {
+		t.Errorf("expected %v but got %v", expected, got)
+	}
+
+	for _, url := range []string{"/m/outside", "/m/api/users/7"} {
+		if _, err := r.FindMatchingRoute(&httpRequest{url: url, method: Get}); err == nil {
+			t.Errorf("expected %s not to be mounted", url)
+		}
+	}
+}
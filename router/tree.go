@@ -0,0 +1,257 @@
+package router
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// tree is a compressed radix tree over route patterns. Static text is shared between patterns and split
+// where they diverge, params get children of their own, so a lookup only looks at each byte of the path
+// once, apart from backtracking out of a branch that turned out to be a dead end.
+type tree struct {
+	path       string // static text, or the constraint of a param
+	name       string // the name of a param or wildcard, from the first pattern that added it
+	indices    string // first byte of every static child, in the same order as static
+	static     []*tree
+	params     []*tree // each matches one non-empty segment, constrained ones first
+	wildcard   *tree   // matches the rest of the path, slashes included
+	isParam    bool
+	constraint *regexp.Regexp
+	routes     map[Request]*node
+}
+
+func newTree() *tree {
+	return &tree{path: "/"}
+}
+
+// insert registers n for method under pattern, e.g. "/users/:id/posts", with params as returned by
+// parsePattern. Patterns must start with a slash. It fails when the route would be unreachable or ambiguous:
+// the same method and pattern registered twice, or a param named differently than another one in the same place.
+func (t *tree) insert(method Request, pattern string, params []routeParam, n *node) error {
+	leaf, err := t.add(pattern[1:], params)
+	if err != nil {
+		return fmt.Errorf("failed adding route %s %s: %w", method, pattern, err)
+	}
+
+	if existing, exists := leaf.routes[method]; exists {
+		return fmt.Errorf("failed adding route %s %s, it duplicates %s %s", method, pattern, method, existing.Route.Url)
+	}
+
+	if leaf.routes == nil {
+		leaf.routes = make(map[Request]*node)
+	}
+	leaf.routes[method] = n
+
+	return nil
+}
+
+// add inserts the rest of a pattern below t, params holding the params still to come, and returns the node it ends at.
+func (t *tree) add(pattern string, params []routeParam) (*tree, error) {
+	if pattern == "" {
+		return t, nil
+	}
+
+	if isDynamic(pattern) && strings.HasSuffix(t.path, "/") {
+		param := params[0]
+		if param.wildcard {
+			if t.wildcard == nil {
+				t.wildcard = &tree{path: pattern, name: param.name}
+			}
+
+			if t.wildcard.name != param.name {
+				return nil, fmt.Errorf("wildcard *%s conflicts with *%s in the same place", param.name, t.wildcard.name)
+			}
+
+			return t.wildcard, nil
+		}
+
+		child := t.paramChild(param)
+		if child.name != param.name {
+			return nil, fmt.Errorf("param %s conflicts with %s in the same place, use one name", param.name, child.name)
+		}
+
+		return child.add(pattern[segmentEnd(pattern):], params[1:])
+	}
+
+	// Static text runs until the next param or wildcard
+	end := len(pattern)
+	for i := 0; i < len(pattern)-1; i++ {
+		if pattern[i] == '/' && isDynamic(pattern[i+1:]) {
+			end = i + 1
+			break
+		}
+	}
+	text := pattern[:end]
+
+	for i := 0; i < len(t.indices); i++ {
+		if t.indices[i] != text[0] {
+			continue
+		}
+
+		child := t.static[i]
+		common := commonPrefix(child.path, text)
+		if common < len(child.path) {
+			child.split(common)
+		}
+
+		return child.add(pattern[common:], params)
+	}
+
+	child := &tree{path: text}
+	t.indices += string(text[0])
+	t.static = append(t.static, child)
+
+	return child.add(pattern[end:], params)
+}
+
+// paramChild returns the child for params with the same constraint as param, creating it when needed.
+func (t *tree) paramChild(param routeParam) *tree {
+	for _, child := range t.params {
+		if child.path == param.expr {
+			return child
+		}
+	}
+
+	child := &tree{path: param.expr, name: param.name, isParam: true, constraint: param.constraint}
+	if param.constraint == nil {
+		t.params = append(t.params, child)
+		return child
+	}
+
+	// Constrained params are more specific, they go before the unconstrained one
+	i := len(t.params)
+	if i > 0 && t.params[i-1].constraint == nil {
+		i--
+	}
+	t.params = slices.Insert(t.params, i, child)
+
+	return child
+}
+
+// split moves everything past the first at bytes of t's path into a new child.
+func (t *tree) split(at int) {
+	child := &tree{
+		path:     t.path[at:],
+		indices:  t.indices,
+		static:   t.static,
+		params:   t.params,
+		wildcard: t.wildcard,
+		routes:   t.routes,
+	}
+
+	t.path = t.path[:at]
+	t.indices = string(child.path[0])
+	t.static = []*tree{child}
+	t.params = nil
+	t.wildcard = nil
+	t.routes = nil
+}
+
+// match calls visit for every node with routes whose pattern matches path, along with the param values in
+// the order they appear in the path, unescaped so they round-trip with Router.URL. Constraints are checked
+// against the unescaped value too. Static text is tried first, then params, then wildcards, so the most
+// specific route wins. Returning true from visit stops the search.
+func (t *tree) match(path string, values []string, visit func(leaf *tree, values []string) bool) bool {
+	if t.isParam {
+		end := strings.IndexByte(path, '/')
+		if end == -1 {
+			end = len(path)
+		}
+
+		value := unescape(path[:end])
+		if end == 0 || t.constraint != nil && !t.constraint.MatchString(value) {
+			return false
+		}
+
+		values = append(values, value)
+		path = path[end:]
+	} else {
+		if !strings.HasPrefix(path, t.path) {
+			return false
+		}
+
+		path = path[len(t.path):]
+	}
+
+	if path == "" && t.routes != nil && visit(t, values) {
+		return true
+	}
+
+	if path != "" {
+		if i := strings.IndexByte(t.indices, path[0]); i != -1 {
+			if t.static[i].match(path, values, visit) {
+				return true
+			}
+		}
+
+		for _, param := range t.params {
+			if param.match(path, values, visit) {
+				return true
+			}
+		}
+	}
+
+	// A wildcard takes whatever is left, even nothing, e.g. "/static/*filepath" matches "/static/"
+	if t.wildcard != nil && t.wildcard.routes != nil {
+		return visit(t.wildcard, append(values, unescape(path)))
+	}
+
+	return false
+}
+
+// lookup returns the route registered for method and path together with its param values.
+func (t *tree) lookup(method Request, path string) (*node, map[string]string) {
+	var found *node
+	var params map[string]string
+	t.match(path, nil, func(leaf *tree, values []string) bool {
+		n, exists := leaf.routes[method]
+		if !exists {
+			return false
+		}
+
+		found = n
+		params = make(map[string]string, len(values))
+		for i, param := range n.Route.params {
+			params[param.name] = values[i]
+		}
+		return true
+	})
+
+	return found, params
+}
+
+// matches returns every route matching path, whatever method it was registered for.
+func (t *tree) matches(path string) []*node {
+	var matches []*node
+	t.match(path, nil, func(leaf *tree, values []string) bool {
+		for _, method := range slices.Sorted(maps.Keys(leaf.routes)) {
+			matches = append(matches, leaf.routes[method])
+		}
+		return false
+	})
+
+	return matches
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return i
+}
+
+// unescape decodes a param value, one that isn't validly escaped is kept as it was sent.
+func unescape(value string) string {
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+
+	return unescaped
+}
@@ -0,0 +1,381 @@
+package router
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestTree_Lookup(t *testing.T) {
+	routes := []string{
+		"/users",
+		"/users/new",
+		"/users/:id",
+		"/users/:id/posts",
+		"/users/new/posts/latest",
+		"/user",
+		"/posts/:postId/comments/:commentId",
+		"/files/a:b",
+		"/:page",
+	}
+	routesTree := newTree()
+	for _, pattern := range routes {
+		r := &router{currentNode: &node{path: "/"}, registry: &registry{routes: routesTree}}
+		r.add(route{Url: pattern, Method: Get})
+	}
+
+	tests := []struct {
+		url             string
+		expectedPattern string
+		expectedParams  map[string]string
+	}{
+		{url: "/users", expectedPattern: "/users", expectedParams: map[string]string{}},
+		{url: "/user", expectedPattern: "/user", expectedParams: map[string]string{}},
+		{url: "/users/new", expectedPattern: "/users/new", expectedParams: map[string]string{}},
+		{url: "/users/42", expectedPattern: "/users/:id", expectedParams: map[string]string{"id": "42"}},
+		{url: "/users/newer", expectedPattern: "/users/:id", expectedParams: map[string]string{"id": "newer"}},
+		{url: "/users/new/posts", expectedPattern: "/users/:id/posts", expectedParams: map[string]string{"id": "new"}},
+		{url: "/users/new/posts/latest", expectedPattern: "/users/new/posts/latest", expectedParams: map[string]string{}},
+		{url: "/posts/1/comments/2", expectedPattern: "/posts/:postId/comments/:commentId", expectedParams: map[string]string{"postId": "1", "commentId": "2"}},
+		{url: "/files/a:b", expectedPattern: "/files/a:b", expectedParams: map[string]string{}},
+		{url: "/about", expectedPattern: "/:page", expectedParams: map[string]string{"page": "about"}},
+		{url: "/users/", expectedPattern: ""},
+		{url: "/users/42/comments", expectedPattern: ""},
+		{url: "/files/ab", expectedPattern: ""},
+		{url: "/", expectedPattern: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			n, params := routesTree.lookup(Get, tt.url)
+			if tt.expectedPattern == "" {
+				if n != nil {
+					t.Errorf("expected no match but got %s", n.Route.Url)
+				}
+				return
+			}
+
+			if n == nil {
+				t.Fatalf("expected %s but got no match", tt.expectedPattern)
+			}
+
+			if n.Route.Url != tt.expectedPattern {
+				t.Errorf("expected %s but got %s", tt.expectedPattern, n.Route.Url)
+			}
+
+			if !maps.Equal(params, tt.expectedParams) {
+				t.Errorf("expected params %v but got %v", tt.expectedParams, params)
+			}
+		})
+	}
+}
+
+func TestTree_Wildcards(t *testing.T) {
+	r := NewRouter()
+	r.Get("/static/*filepath", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Get("/static/favicon.ico", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Get("/files/:name", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Get("/files/*path", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Get("/files/:name/meta", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Get("/*page", func(writer HTTPWriter, request HTTPRequest) {})
+
+	tests := []struct {
+		url             string
+		expectedPattern string
+		expectedParams  map[string]string
+	}{
+		{url: "/static/css/site.css", expectedPattern: "/static/*filepath", expectedParams: map[string]string{"filepath": "css/site.css"}},
+		{url: "/static/js/app.js", expectedPattern: "/static/*filepath", expectedParams: map[string]string{"filepath": "js/app.js"}},
+		{url: "/static/", expectedPattern: "/static/*filepath", expectedParams: map[string]string{"filepath": ""}},
+		{url: "/static/favicon.ico", expectedPattern: "/static/favicon.ico", expectedParams: map[string]string{}},
+		{url: "/files/a.txt", expectedPattern: "/files/:name", expectedParams: map[string]string{"name": "a.txt"}},
+		{url: "/files/a.txt/meta", expectedPattern: "/files/:name/meta", expectedParams: map[string]string{"name": "a.txt"}},
+		{url: "/files/dir/a.txt", expectedPattern: "/files/*path", expectedParams: map[string]string{"path": "dir/a.txt"}},
+		{url: "/static", expectedPattern: "/*page", expectedParams: map[string]string{"page": "static"}},
+		{url: "/about/team", expectedPattern: "/*page", expectedParams: map[string]string{"page": "about/team"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			request := &httpRequest{url: tt.url, method: Get}
+			n, err := r.FindMatchingRoute(request)
+			if err != nil {
+				t.Fatalf("expected %s but got %s", tt.expectedPattern, err)
+			}
+
+			if n.Route.Url != tt.expectedPattern {
+				t.Errorf("expected %s but got %s", tt.expectedPattern, n.Route.Url)
+			}
+
+			if !maps.Equal(request.urlParams, tt.expectedParams) {
+				t.Errorf("expected params %v but got %v", tt.expectedParams, request.urlParams)
+			}
+		})
+	}
+
+	t.Run("wildcard not last", func(t *testing.T) {
+		assertPanic(t, func() { r.Get("/assets/*path/edit", func(writer HTTPWriter, request HTTPRequest) {}) })
+		assertPanic(t, func() { r.Get("/assets/*", func(writer HTTPWriter, request HTTPRequest) {}) })
+	})
+}
+
+func TestTree_Constraints(t *testing.T) {
+	r := NewRouter()
+	r.Get("/users/:id<int>", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Get("/users/:name", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Get("/users/{code:[A-Z]{3}}", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Get("/users/me", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Get("/orders/:id<uuid>/items/{item:[0-9]+}", func(writer HTTPWriter, request HTTPRequest) {})
+
+	tests := []struct {
+		url             string
+		expectedPattern string
+	}{
+		{url: "/users/42", expectedPattern: "/users/:id<int>"},
+		{url: "/users/-7", expectedPattern: "/users/:id<int>"},
+		{url: "/users/ABC", expectedPattern: "/users/{code:[A-Z]{3}}"},
+		{url: "/users/ABCD", expectedPattern: "/users/:name"},
+		{url: "/users/me", expectedPattern: "/users/me"},
+		{url: "/users/42abc", expectedPattern: "/users/:name"},
+		{url: "/orders/123e4567-e89b-12d3-a456-426614174000/items/3", expectedPattern: "/orders/:id<uuid>/items/{item:[0-9]+}"},
+		{url: "/orders/123/items/3", expectedPattern: ""},
+		{url: "/orders/123e4567-e89b-12d3-a456-426614174000/items/x", expectedPattern: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			n, err := r.FindMatchingRoute(&httpRequest{url: tt.url, method: Get})
+			if tt.expectedPattern == "" {
+				if err == nil {
+					t.Errorf("expected no match but got %s", n.Route.Url)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected %s but got %s", tt.expectedPattern, err)
+			}
+
+			if n.Route.Url != tt.expectedPattern {
+				t.Errorf("expected %s but got %s", tt.expectedPattern, n.Route.Url)
+			}
+		})
+	}
+
+	t.Run("typed accessors", func(t *testing.T) {
+		request := &httpRequest{url: "/orders/123E4567-e89b-12d3-a456-426614174000/items/3", method: Get}
+		if _, err := r.FindMatchingRoute(request); err != nil {
+			t.Fatalf("expected a match but got %s", err)
+		}
+
+		item, err := request.GetURLParamInt("item")
+		if err != nil || item != 3 {
+			t.Errorf("expected item 3 but got %d, %v", item, err)
+		}
+
+		id, err := request.GetURLParamUUID("id")
+		if err != nil || id.String() != "123e4567-e89b-12d3-a456-426614174000" {
+			t.Errorf("expected the order UUID but got %s, %v", id, err)
+		}
+
+		if _, err := request.GetURLParamInt("id"); err == nil {
+			t.Errorf("expected a UUID not to parse as an int")
+		}
+
+		if _, err := request.GetURLParamUUID("item"); err == nil {
+			t.Errorf("expected an int not to parse as a UUID")
+		}
+	})
+}
+
+func TestTree_LookupMethod(t *testing.T) {
+	r := NewRouter()
+	r.Get("/users/new", func(writer HTTPWriter, request HTTPRequest) {})
+	r.Put("/users/:id", func(writer HTTPWriter, request HTTPRequest) {})
+
+	// The static route has no PUT, so the param route takes it
+	request := &httpRequest{url: "/users/new", method: Put}
+	n, err := r.FindMatchingRoute(request)
+	if err != nil {
+		t.Fatalf("expected a match but got %s", err)
+	}
+
+	if n.Route.Url != "/users/:id" {
+		t.Errorf("expected /users/:id but got %s", n.Route.Url)
+	}
+
+	if id, _ := request.GetURLParam("id"); id != "new" {
+		t.Errorf("expected id new but got %s", id)
+	}
+}
+
+func TestTree_Groups(t *testing.T) {
+	r := NewRouter()
+	r.Group("/api/v1", func(api Router) {
+		api.Get("/users/:id", func(writer HTTPWriter, request HTTPRequest) {})
+		api.Group("/teams/:team", func(teams Router) {
+			teams.Get("/members/:member", func(writer HTTPWriter, request HTTPRequest) {})
+		})
+	})
+
+	tests := []struct {
+		url            string
+		expectedParams map[string]string
+	}{
+		{url: "/api/v1/users/7", expectedParams: map[string]string{"id": "7"}},
+		{url: "/api/v1/teams/core/members/ana", expectedParams: map[string]string{"team": "core", "member": "ana"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			request := &httpRequest{url: tt.url, method: Get}
+			if _, err := r.FindMatchingRoute(request); err != nil {
+				t.Fatalf("expected a match but got %s", err)
+			}
+
+			if !maps.Equal(request.urlParams, tt.expectedParams) {
+				t.Errorf("expected params %v but got %v", tt.expectedParams, request.urlParams)
+			}
+		})
+	}
+}
+
+// legacyCompareRoutes and legacyMatchingNodes are the matcher the tree replaced. They're only a fixture for
+// BenchmarkLegacy_Lookup, nothing else uses or tests them.
+func legacyCompareRoutes(requestUrl, routerUrl string) bool {
+	requestUrlParts := strings.Split(requestUrl, "/")
+	routerUrlParts := strings.Split(routerUrl, "/")
+
+	if routerUrl == "/" {
+		routerUrlParts = []string{""}
+	}
+
+	if requestUrl == "/" {
+		requestUrlParts = []string{""}
+	}
+
+	if len(requestUrlParts) != len(routerUrlParts) {
+		return false
+	}
+
+	for i, part := range routerUrlParts {
+		if part == "" {
+			continue
+		}
+
+		isDynamic := string(part[0]) == ":"
+		if isDynamic {
+			continue
+		}
+
+		if part != requestUrlParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func legacyFindMatchingNode(requestUrl string, method Request, n *node) *node {
+	for _, match := range legacyMatchingNodes(requestUrl, n) {
+		if match.Route.Method == method {
+			return match
+		}
+	}
+
+	return nil
+}
+
+func legacyMatchingNodes(requestUrl string, n *node) []*node {
+	var matches []*node
+	isRoot := n.path == "/"
+	if n.Route != nil && legacyCompareRoutes(requestUrl, n.path) {
+		matches = append(matches, n)
+	}
+
+	var requestUrlsParts []string
+	urlParts := strings.Split(requestUrl, "/")
+	for i, part := range urlParts {
+		if isRoot && i != 0 {
+			requestUrlsParts = append(requestUrlsParts, "/"+part)
+		} else if i != 0 && i != 1 {
+			requestUrlsParts = append(requestUrlsParts, "/"+part)
+		}
+	}
+
+	for i := range n.children {
+		child := n.children[i]
+		if child.Route != nil && legacyCompareRoutes(requestUrl, child.path) {
+			matches = append(matches, child)
+		} else if len(requestUrlsParts) > 0 && child.path == requestUrlsParts[0] {
+			matches = append(matches, legacyMatchingNodes(strings.Join(requestUrlsParts, ""), child)...)
+		}
+	}
+
+	return matches
+}
+
+// benchmarkRoutes builds a 400 route API: 40 resources with 10 routes each.
+func benchmarkRoutes() []string {
+	var routes []string
+	for i := 0; i < 40; i++ {
+		resource := fmt.Sprintf("/resource%d", i)
+		routes = append(routes,
+			resource,
+			resource+"/search",
+			resource+"/:id",
+			resource+"/:id/edit",
+			resource+"/:id/history",
+			resource+"/:id/comments",
+			resource+"/:id/comments/:commentId",
+			resource+"/:id/comments/:commentId/replies",
+			resource+"/:id/attachments/:attachmentId",
+			resource+"/:id/attachments/:attachmentId/download",
+		)
+	}
+
+	return routes
+}
+
+var benchmarkURLs = []string{
+	"/resource0",
+	"/resource20/search",
+	"/resource39/123/comments/456/replies",
+	"/resource17/abc/attachments/9/download",
+	"/resource39/missing/route",
+}
+
+func BenchmarkTree_Lookup(b *testing.B) {
+	r := NewRouter().(*router)
+	for _, pattern := range benchmarkRoutes() {
+		r.Get(pattern, func(writer HTTPWriter, request HTTPRequest) {})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, url := range benchmarkURLs {
+			r.registry.routes.lookup(Get, url)
+		}
+	}
+}
+
+func BenchmarkLegacy_Lookup(b *testing.B) {
+	root := &node{path: "/"}
+	for _, pattern := range benchmarkRoutes() {
+		root.children = append(root.children, &node{
+			parent: root,
+			path:   pattern,
+			Route:  &route{Url: pattern, Method: Get},
+		})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, url := range benchmarkURLs {
+			legacyFindMatchingNode(url, Get, root)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package router
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// UUID is a parsed UUID, as returned by HTTPRequest.GetURLParamUUID.
+type UUID [16]byte
+
+// ParseUUID parses the canonical 8-4-4-4-12 hex form, e.g. "123e4567-e89b-12d3-a456-426614174000".
+func ParseUUID(value string) (UUID, error) {
+	var uuid UUID
+	if len(value) != 36 || value[8] != '-' || value[13] != '-' || value[18] != '-' || value[23] != '-' {
+		return uuid, fmt.Errorf("invalid UUID: %q", value)
+	}
+
+	digits := value[0:8] + value[9:13] + value[14:18] + value[19:23] + value[24:36]
+	if _, err := hex.Decode(uuid[:], []byte(digits)); err != nil {
+		return UUID{}, fmt.Errorf("invalid UUID: %q", value)
+	}
+
+	return uuid, nil
+}
+
+func (u UUID) String() string {
+	digits := hex.EncodeToString(u[:])
+	return digits[0:8] + "-" + digits[8:12] + "-" + digits[12:16] + "-" + digits[16:20] + "-" + digits[20:32]
+}
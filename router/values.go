@@ -0,0 +1,67 @@
+package router
+
+import "sync"
+
+// Key identifies a value stored on a request, T is the type of the value. Keys are compared by identity,
+// so two keys made with the same name don't clash. Declare them once, as package level variables:
+//
+//	var UserKey = router.NewKey[*User]("user")
+//
+//	UserKey.Set(request, user) // in a middleware
+//	user, ok := UserKey.Get(request) // in the handler
+type Key[T any] struct {
+	name string
+}
+
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// Set stores value on request under k, replacing what was stored before.
+func (k *Key[T]) Set(request HTTPRequest, value T) {
+	request.SetValue(k, value)
+}
+
+// Get returns the value stored on request under k, ok is false when nothing was.
+func (k *Key[T]) Get(request HTTPRequest) (value T, ok bool) {
+	stored, ok := request.Value(k)
+	if !ok {
+		return value, false
+	}
+
+	return stored.(T), true
+}
+
+// String is the name the key was made with.
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// values holds what middlewares and handlers stored on a request. It's safe to use from several goroutines,
+// e.g. a handler fanning out work.
+type values struct {
+	mu     sync.RWMutex
+	values map[any]any
+}
+
+func (v *values) set(key, value any) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.values == nil {
+		v.values = make(map[any]any)
+	}
+	v.values[key] = value
+}
+
+func (v *values) get(key any) (any, bool) {
+	if v == nil {
+		return nil, false
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	value, ok := v.values[key]
+	return value, ok
+}
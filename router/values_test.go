@@ -0,0 +1,119 @@
+package router
+
+import (
+	"sync"
+	"testing"
+)
+
+type testUser struct {
+	name string
+}
+
+func TestKey(t *testing.T) {
+	userKey := NewKey[*testUser]("user")
+	tenantKey := NewKey[string]("tenant")
+	otherTenantKey := NewKey[string]("tenant")
+
+	request := NewHTTPRequest()
+	if _, ok := userKey.Get(request); ok {
+		t.Errorf("expected no user before one is set")
+	}
+
+	userKey.Set(request, &testUser{name: "ada"})
+	tenantKey.Set(request, "acme")
+
+	tests := []struct {
+		name          string
+		get           func() (any, bool)
+		expectedValue any
+		expectedOk    bool
+	}{
+		{
+			name:          "typed value",
+			get:           func() (any, bool) { user, ok := userKey.Get(request); return user.name, ok },
+			expectedValue: "ada",
+			expectedOk:    true,
+		},
+		{
+			name:          "second key",
+			get:           func() (any, bool) { return tenantKey.Get(request) },
+			expectedValue: "acme",
+			expectedOk:    true,
+		},
+		{
+			name:          "keys with the same name don't clash",
+			get:           func() (any, bool) { return otherTenantKey.Get(request) },
+			expectedValue: "",
+			expectedOk:    false,
+		},
+		{
+			name:          "untyped access",
+			get:           func() (any, bool) { return request.Value(tenantKey) },
+			expectedValue: "acme",
+			expectedOk:    true,
+		},
+		{
+			name:          "request put together by hand",
+			get:           func() (any, bool) { return tenantKey.Get(&httpRequest{}) },
+			expectedValue: "",
+			expectedOk:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok := tt.get()
+			if value != tt.expectedValue || ok != tt.expectedOk {
+				t.Errorf("expected %v, %v but got %v, %v", tt.expectedValue, tt.expectedOk, value, ok)
+			}
+		})
+	}
+}
+
+func TestKey_ThroughMiddlewares(t *testing.T) {
+	userKey := NewKey[*testUser]("user")
+	requestIDKey := NewKey[int]("request id")
+
+	middlewares := []MiddlewareFunc{
+		func(writer HTTPWriter, request HTTPRequest, next func()) {
+			requestIDKey.Set(request, 42)
+			next()
+		},
+		func(writer HTTPWriter, request HTTPRequest, next func()) {
+			userKey.Set(request, &testUser{name: "ada"})
+			next()
+		},
+	}
+
+	var user *testUser
+	var requestID int
+	request := NewHTTPRequest()
+	ApplyMiddlewares(nil, request, middlewares, func(writer HTTPWriter, request HTTPRequest) {
+		user, _ = userKey.Get(request)
+		requestID, _ = requestIDKey.Get(request)
+	})()
+
+	if user == nil || user.name != "ada" || requestID != 42 {
+		t.Errorf("expected the handler to see the values set by middlewares but got %v and %d", user, requestID)
+	}
+}
+
+func TestKey_Concurrent(t *testing.T) {
+	counterKey := NewKey[int]("counter")
+	request := NewHTTPRequest()
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counterKey.Set(request, i)
+			counterKey.Get(request)
+		}()
+	}
+	wg.Wait()
+
+	if _, ok := counterKey.Get(request); !ok {
+		t.Errorf("expected a value after concurrent sets")
+	}
+}
@@ -0,0 +1,110 @@
+package router
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// WalkFunc is called by Router.Walk for every registered route. fullPath has the group prefixes resolved,
+// and middlewares are the ones the route runs through, outermost first. Returning an error stops the walk.
+type WalkFunc func(method Request, fullPath string, middlewareCount int, handler func(writer HTTPWriter, request HTTPRequest), middlewares []MiddlewareFunc) error
+
+// Walk calls fn for every route registered on r and its groups, sorted by path and then method.
+// Walking a group only visits the routes registered through it.
+func (r *router) Walk(fn WalkFunc) error {
+	var nodes []*node
+	r.registry.routes.walk(func(n *node) {
+		if hasAncestor(n, r.currentNode) {
+			nodes = append(nodes, n)
+		}
+	})
+
+	slices.SortFunc(nodes, func(a, b *node) int {
+		return cmp.Or(cmp.Compare(a.Route.Url, b.Route.Url), cmp.Compare(a.Route.Method, b.Route.Method))
+	})
+
+	for _, n := range nodes {
+		middlewares := GetMiddlewares(n)
+		if err := fn(n.Route.Method, n.Route.Url, len(middlewares), n.Route.Handler, middlewares); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walk calls fn for every route in the tree.
+func (t *tree) walk(fn func(n *node)) {
+	for _, n := range t.routes {
+		fn(n)
+	}
+
+	for _, child := range t.static {
+		child.walk(fn)
+	}
+
+	for _, child := range t.params {
+		child.walk(fn)
+	}
+
+	if t.wildcard != nil {
+		t.wildcard.walk(fn)
+	}
+}
+
+func hasAncestor(n *node, ancestor *node) bool {
+	for ; n != nil; n = n.parent {
+		if n == ancestor {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PrintRoutes writes the routes of router as an aligned table of method, path, handler and middlewares,
+// e.g. to log them at startup or from a debug endpoint, since an HTTPWriter is an io.Writer too.
+func PrintRoutes(w io.Writer, router Router) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "METHOD\tPATH\tHANDLER\tMIDDLEWARES")
+	err := router.Walk(func(method Request, fullPath string, middlewareCount int, handler func(writer HTTPWriter, request HTTPRequest), middlewares []MiddlewareFunc) error {
+		names := "-"
+		if len(middlewares) > 0 {
+			var parts []string
+			for _, middleware := range middlewares {
+				parts = append(parts, funcName(middleware))
+			}
+			names = strings.Join(parts, ", ")
+		}
+
+		_, err := fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", method, fullPath, funcName(handler), names)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return table.Flush()
+}
+
+// funcName returns the name of fn without its package path, e.g. "main.showUser" or "main.main.func1" for closures.
+func funcName(fn any) string {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return "-"
+	}
+
+	f := runtime.FuncForPC(value.Pointer())
+	if f == nil {
+		return "-"
+	}
+
+	name := f.Name()
+	return name[strings.LastIndex(name, "/")+1:]
+}
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func walkHandler(writer HTTPWriter, request HTTPRequest) {}
+
+func walkMiddleware(writer HTTPWriter, request HTTPRequest, next func()) { next() }
+
+func Test_router_Walk(t *testing.T) {
+	r := NewRouter()
+	r.Use(walkMiddleware)
+	r.Post("/users", walkHandler)
+	r.Get("/users", walkHandler)
+	r.Group("/api", func(api Router) {
+		api.Use(walkMiddleware)
+		api.Get("/teams/:team", walkHandler)
+		api.Group("/v2", func(v2 Router) {
+			v2.Get("/status", walkHandler)
+			v2.Use(walkMiddleware)
+		})
+	})
+
+	type walked struct {
+		method          Request
+		fullPath        string
+		middlewareCount int
+	}
+	var routes []walked
+	err := r.Walk(func(method Request, fullPath string, middlewareCount int, handler func(writer HTTPWriter, request HTTPRequest), middlewares []MiddlewareFunc) error {
+		routes = append(routes, walked{method: method, fullPath: fullPath, middlewareCount: middlewareCount})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed walking routes: %s", err)
+	}
+
+	expected := []walked{
+		{method: Get, fullPath: "/api/teams/:team", middlewareCount: 2},
+		{method: Get, fullPath: "/api/v2/status", middlewareCount: 3},
+		{method: Get, fullPath: "/users", middlewareCount: 1},
+		{method: Post, fullPath: "/users", middlewareCount: 1},
+	}
+	if len(routes) != len(expected) {
+		t.Fatalf("expected routes %v but got %v", expected, routes)
+	}
+	for i := range expected {
+		if routes[i] != expected[i] {
+			t.Errorf("expected route %v but got %v", expected[i], routes[i])
+		}
+	}
+
+	t.Run("errors stop the walk", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		err := r.Walk(func(method Request, fullPath string, middlewareCount int, handler func(writer HTTPWriter, request HTTPRequest), middlewares []MiddlewareFunc) error {
+			calls++
+			return stop
+		})
+
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("expected the walk to stop after one call with %v but got %d calls and %v", stop, calls, err)
+		}
+	})
+}
+
+func TestPrintRoutes(t *testing.T) {
+	r := NewRouter()
+	r.Get("/users/:id", walkHandler)
+	r.Group("/admin", func(admin Router) {
+		admin.Use(walkMiddleware)
+		admin.Delete("/users/:id", walkHandler)
+	})
+
+	var table strings.Builder
+	if err := PrintRoutes(&table, r); err != nil {
+		t.Fatalf("failed printing routes: %s", err)
+	}
+
+	expected := "METHOD  PATH              HANDLER             MIDDLEWARES\n" +
+		"DELETE  /admin/users/:id  router.walkHandler  router.walkMiddleware\n" +
+		"GET     /users/:id        router.walkHandler  -\n"
+	if table.String() != expected {
+		t.Errorf("expected table\n%s\nbut got\n%s", expected, table.String())
+	}
+}
@@ -1,21 +1,49 @@
 package router
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
 )
 
+// maxPendingBytes is how much body a writer holds back before sending the headers. Responses that
+// fit get an exact Content-Length, bigger ones are streamed.
+const maxPendingBytes = 4096
+
+// ErrResponseFinished is returned when writing to a response that was already completed.
+var ErrResponseFinished = errors.New("response already finished")
+
 type HTTPWriter interface {
 	Response(payload string, statusCode int)
-	Header() Header
-	addHeader(header Header)
+	WriteHeader(statusCode int)
+	Write(p []byte) (int, error)
+	Flush() error
+	Finish() error
+	Header() Headers
+	SetKeepAlive(keepAlive bool)
+	SetProto(proto string)
+	KeepAlive() bool
+	Written() bool
+	HeaderSent() bool
+	Reset()
 }
 
 type httpWriter struct {
-	conn    Connection
-	method  Request
-	headers []Header
+	conn          Connection
+	method        Request
+	proto         string
+	headers       Headers
+	connection    string
+	status        int
+	contentLength int    // set by Response, -1 when unknown
+	pending       []byte // body written before the headers were sent
+	headLength    int    // body written to a HEAD response, counted but never sent
+	headerSent    bool
+	chunked       bool
+	finished      bool
+	err           error
 }
 
 type Connection interface {
@@ -24,39 +52,256 @@ type Connection interface {
 
 func NewHTTPWriter(conn Connection, method Request) HTTPWriter {
 	return &httpWriter{
-		conn:   conn,
-		method: method,
+		conn:          conn,
+		method:        method,
+		headers:       Headers{},
+		contentLength: -1,
 	}
 }
 
+// Response writes payload as the complete response.
 func (h *httpWriter) Response(payload string, statusCode int) {
-	// Create HTTP format response
+	if h.status != 0 {
+		return
+	}
+
+	if len(payload) > 0 {
+		h.contentLength = len(payload)
+	}
+	h.WriteHeader(statusCode)
+	h.Write([]byte(payload))
+	h.Finish()
+}
+
+// WriteHeader sets the status code, only the first call counts. The headers themselves go out with
+// the first Flush, once enough body was written, or when the response finishes.
+func (h *httpWriter) WriteHeader(statusCode int) {
+	if h.status != 0 {
+		return
+	}
+
+	h.status = statusCode
+}
+
+// Write adds p to the body, calling WriteHeader(200) first when needed. Unless a Content-Length header
+// was set, a body that outgrows maxPendingBytes is sent with Transfer-Encoding: chunked. Responses to HEAD
+// requests only count what's written, so they get the Content-Length a GET would have had.
+func (h *httpWriter) Write(p []byte) (int, error) {
+	if h.finished {
+		return 0, ErrResponseFinished
+	}
+
+	if h.err != nil {
+		return 0, h.err
+	}
+
+	if h.status == 0 {
+		h.WriteHeader(200)
+	}
+
+	if h.method == Head && !h.headerSent {
+		h.headLength += len(p)
+		return len(p), nil
+	}
+
+	if !h.headerSent {
+		h.pending = append(h.pending, p...)
+		if len(h.pending) > maxPendingBytes {
+			if err := h.sendHeader(false); err != nil {
+				return 0, err
+			}
+		}
+
+		return len(p), nil
+	}
+
+	if err := h.writeBody(p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Flush sends the headers and everything written so far to the client.
+func (h *httpWriter) Flush() error {
+	if h.finished {
+		return nil
+	}
+
+	if h.status == 0 {
+		h.WriteHeader(200)
+	}
+
+	if !h.headerSent {
+		return h.sendHeader(false)
+	}
+
+	return h.err
+}
+
+// Finish completes the response, sending the headers if they're still held back and ending a chunked body.
+// The server calls it once the handler returns, it does nothing when no response was started.
+func (h *httpWriter) Finish() error {
+	if h.finished || h.status == 0 {
+		return h.err
+	}
+
+	if !h.headerSent {
+		if err := h.sendHeader(true); err != nil {
+			return err
+		}
+	} else if h.chunked && h.sendsBody() {
+		h.write([]byte("0\r\n\r\n"))
+	}
+	h.finished = true
+
+	return h.err
+}
+
+// sendHeader writes the status line, headers and the pending body. When final, the pending body is all
+// there is and its length is known, otherwise the body is chunked, or delimited by closing the connection
+// for HTTP/1.0 clients that don't understand chunks.
+func (h *httpWriter) sendHeader(final bool) error {
 	var response strings.Builder
-	status := strconv.Itoa(statusCode)
+	h.headerSent = true
 
 	// Status line
-	response.WriteString(fmt.Sprintf("HTTP/1.1 %s %s\r\n", status, getStatusMessage(statusCode)))
+	response.WriteString(fmt.Sprintf("HTTP/1.1 %s %s\r\n", strconv.Itoa(h.status), getStatusMessage(h.status)))
 
 	// Headers
-	if len(payload) > 0 {
-		response.WriteString(fmt.Sprintf("%s: %v\r\n", ContentLength, len(payload)))
+	switch {
+	case !bodyAllowed(h.status) || h.headers.Has(ContentLength):
+	case h.contentLength >= 0:
+		response.WriteString(fmt.Sprintf("%s: %v\r\n", ContentLength, h.contentLength))
+	case final && (len(h.pending)+h.headLength > 0 || h.connection == "keep-alive"): // without a length only closing the connection ends the body
+		response.WriteString(fmt.Sprintf("%s: %v\r\n", ContentLength, len(h.pending)+h.headLength))
+	case final:
+	case h.proto == "HTTP/1.0":
+		h.connection = "close"
+	default:
+		h.chunked = true
+		response.WriteString(fmt.Sprintf("%s: %s\r\n", TransferEncoding, "chunked"))
 	}
-	for _, header := range h.headers {
-		for key, value := range header.Get() {
-			response.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
-		}
+	if h.connection != "" && !h.headers.Has(ConnectionHeader) {
+		response.WriteString(fmt.Sprintf("%s: %s\r\n", ConnectionHeader, h.connection))
+	}
+	for key, value := range h.headers.All() {
+		response.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
 	}
 
 	// Required empty line between body headers
 	response.WriteString("\r\n")
-	response.WriteString(payload)
 
 	// Body
-	fmt.Fprint(h.conn, response.String())
+	pending := h.pending
+	h.pending = nil
+	if !h.sendsBody() {
+		return h.write([]byte(response.String()))
+	}
+
+	if h.chunked {
+		if len(pending) > 0 {
+			response.WriteString(fmt.Sprintf("%x\r\n", len(pending)))
+			response.Write(pending)
+			response.WriteString("\r\n")
+		}
+		return h.write([]byte(response.String()))
+	}
+
+	response.Write(pending)
+	return h.write([]byte(response.String()))
+}
+
+func (h *httpWriter) writeBody(p []byte) error {
+	if !h.sendsBody() || len(p) == 0 {
+		return nil
+	}
+
+	if h.chunked {
+		return h.write([]byte(fmt.Sprintf("%x\r\n%s\r\n", len(p), p)))
+	}
+
+	return h.write(p)
+}
+
+func (h *httpWriter) write(p []byte) error {
+	if _, err := h.conn.Write(p); err != nil {
+		h.err = err
+		h.connection = "close" // e.g. the write deadline passed, the connection can't be trusted anymore
+	}
+
+	return h.err
+}
+
+// SetKeepAlive decides which Connection header the response carries. Writers that never
+// had it called, like the ones in tests, don't send a Connection header at all.
+func (h *httpWriter) SetKeepAlive(keepAlive bool) {
+	if keepAlive {
+		h.connection = "keep-alive"
+		return
+	}
+
+	h.connection = "close"
 }
 
-func (h *httpWriter) addHeader(header Header) {
-	h.headers = append(h.headers, header)
+// SetProto tells the writer which HTTP version the client spoke, HTTP/1.0 clients don't get chunked bodies.
+func (h *httpWriter) SetProto(proto string) {
+	h.proto = proto
+}
+
+// KeepAlive reports whether the connection may be reused once the response is written.
+// Handlers can force a close by adding a "Connection: close" header themselves.
+func (h *httpWriter) KeepAlive() bool {
+	if h.connection == "close" {
+		return false
+	}
+
+	for _, value := range h.headers.Values(ConnectionHeader) {
+		if hasToken(value, "close") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Header returns the response headers. Changes made after the headers were sent have no effect.
+func (h *httpWriter) Header() Headers {
+	return h.headers
+}
+
+// Written reports whether a response was started, through Response, WriteHeader or Write.
+func (h *httpWriter) Written() bool {
+	return h.status != 0
+}
+
+// HeaderSent reports whether the status line and headers already went out to the client.
+func (h *httpWriter) HeaderSent() bool {
+	return h.headerSent
+}
+
+// Reset drops the status, headers and body written so far, so a different response can be written instead.
+// It does nothing once the headers were sent.
+func (h *httpWriter) Reset() {
+	if h.headerSent {
+		return
+	}
+
+	h.status = 0
+	h.headers = Headers{}
+	h.contentLength = -1
+	h.pending = nil
+	h.headLength = 0
+}
+
+// sendsBody reports whether the body goes out, HEAD responses carry the headers of the matching GET response only.
+func (h *httpWriter) sendsBody() bool {
+	return bodyAllowed(h.status) && h.method != Head
+}
+
+// bodyAllowed reports whether responses with statusCode may carry a body.
+func bodyAllowed(statusCode int) bool {
+	return statusCode >= 200 && statusCode != 204 && statusCode != 304
 }
 
 func getStatusMessage(statusCode int) string {
@@ -81,13 +326,28 @@ func getStatusMessage(statusCode int) string {
 		return "Forbidden"
 	case 404:
 		return "Not Found"
+	case 405:
+		return "Method Not Allowed"
+	case 408:
+		return "Request Timeout"
+	case 414:
+		return "URI Too Long"
+	case 431:
+		return "Request Header Fields Too Large"
 	case 500:
 		return "Internal Server Error"
+	case 501:
+		return "Not Implemented"
 	case 502:
 		return "Bad Gateway"
 	case 503:
 		return "Service Unavailable"
+	case 505:
+		return "HTTP Version Not Supported"
 	default:
+		if text := http.StatusText(statusCode); text != "" { // e.g. codes net/http handlers send
+			return text
+		}
 		return "Unknown"
 	}
 }
@@ -1,7 +1,10 @@
 package router
 
 import (
+	"errors"
+	"fmt"
 	"slices"
+	"strings"
 	"testing"
 )
 
@@ -131,6 +134,17 @@ func TestHttpWriter_FormatResponse(t *testing.T) {
 			},
 			expectedWrite: []byte("HTTP/1.1 200 OK\r\nContent-Length: 71\r\nContent-Type: application/json\r\nHost: api.example.com\r\n\r\n{\"user\":{\"id\":123,\"email\":\"test@example.com\",\"roles\":[\"admin\",\"user\"]}}"),
 		},
+		{
+			name:       "GET request with repeated header",
+			method:     Get,
+			payload:    "ok",
+			statusCode: 200,
+			headers: []mockHeader{
+				{key: SetCookie, value: "session=AbC; HttpOnly"},
+				{key: "set-cookie", value: "theme=dark"},
+			},
+			expectedWrite: []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nSet-Cookie: session=AbC; HttpOnly\r\nSet-Cookie: theme=dark\r\n\r\nok"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -148,3 +162,264 @@ func TestHttpWriter_FormatResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestHttpWriter_KeepAlive(t *testing.T) {
+	tests := []struct {
+		name              string
+		keepAlive         bool
+		headers           []mockHeader
+		expectedWrite     []byte
+		expectedKeepAlive bool
+	}{
+		{
+			name:              "keep-alive connection",
+			keepAlive:         true,
+			expectedWrite:     []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: keep-alive\r\n\r\nOK"),
+			expectedKeepAlive: true,
+		},
+		{
+			name:              "closing connection",
+			keepAlive:         false,
+			expectedWrite:     []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nOK"),
+			expectedKeepAlive: false,
+		},
+		{
+			name:      "handler closes the connection",
+			keepAlive: true,
+			headers: []mockHeader{
+				{key: ConnectionHeader, value: "close"},
+			},
+			expectedWrite:     []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nOK"),
+			expectedKeepAlive: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConn := &mockConnection{}
+			writer := NewHTTPWriter(mockConn, Get)
+			writer.SetKeepAlive(tt.keepAlive)
+			for _, h := range tt.headers {
+				writer.Header().Add(h.key, h.value)
+			}
+			writer.Response("OK", 200)
+
+			if !slices.Equal(mockConn.written, tt.expectedWrite) {
+				t.Errorf("expected write to be %s but got %s", tt.expectedWrite, mockConn.written)
+			}
+
+			if writer.KeepAlive() != tt.expectedKeepAlive {
+				t.Errorf("expected keep-alive to be %v but got %v", tt.expectedKeepAlive, writer.KeepAlive())
+			}
+		})
+	}
+}
+
+func TestHttpWriter_Streaming(t *testing.T) {
+	large := strings.Repeat("a", maxPendingBytes+1)
+	tests := []struct {
+		name          string
+		method        Request
+		proto         string
+		keepAlive     bool
+		headers       []mockHeader
+		write         func(writer HTTPWriter)
+		expectedWrite string
+	}{
+		{
+			name:      "small writes get a content length",
+			proto:     "HTTP/1.1",
+			keepAlive: true,
+			write: func(writer HTTPWriter) {
+				writer.Write([]byte("Hello "))
+				writer.Write([]byte("World"))
+			},
+			expectedWrite: "HTTP/1.1 200 OK\r\nContent-Length: 11\r\nConnection: keep-alive\r\n\r\nHello World",
+		},
+		{
+			name:      "status without body on a kept alive connection",
+			proto:     "HTTP/1.1",
+			keepAlive: true,
+			write: func(writer HTTPWriter) {
+				writer.WriteHeader(404)
+			},
+			expectedWrite: "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\nConnection: keep-alive\r\n\r\n",
+		},
+		{
+			name:      "flushing switches to chunks",
+			proto:     "HTTP/1.1",
+			keepAlive: true,
+			write: func(writer HTTPWriter) {
+				writer.WriteHeader(201)
+				writer.Write([]byte("Hello"))
+				writer.Flush()
+				writer.Write([]byte(" World"))
+			},
+			expectedWrite: "HTTP/1.1 201 Created\r\nTransfer-Encoding: chunked\r\nConnection: keep-alive\r\n\r\n5\r\nHello\r\n6\r\n World\r\n0\r\n\r\n",
+		},
+		{
+			name:      "large bodies are chunked",
+			proto:     "HTTP/1.1",
+			keepAlive: true,
+			write: func(writer HTTPWriter) {
+				writer.Write([]byte(large))
+			},
+			expectedWrite: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nConnection: keep-alive\r\n\r\n" +
+				fmt.Sprintf("%x\r\n%s\r\n0\r\n\r\n", len(large), large),
+		},
+		{
+			name:      "known content length is streamed as is",
+			proto:     "HTTP/1.1",
+			keepAlive: true,
+			headers: []mockHeader{
+				{key: ContentLength, value: "11"},
+			},
+			write: func(writer HTTPWriter) {
+				writer.Write([]byte("Hello"))
+				writer.Flush()
+				writer.Write([]byte(" World"))
+			},
+			expectedWrite: "HTTP/1.1 200 OK\r\nConnection: keep-alive\r\nContent-Length: 11\r\n\r\nHello World",
+		},
+		{
+			name:      "HTTP/1.0 streams until the connection closes",
+			proto:     "HTTP/1.0",
+			keepAlive: true,
+			write: func(writer HTTPWriter) {
+				writer.Write([]byte("Hello"))
+				writer.Flush()
+				writer.Write([]byte(" World"))
+			},
+			expectedWrite: "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nHello World",
+		},
+		{
+			name:      "no content drops the body",
+			proto:     "HTTP/1.1",
+			keepAlive: true,
+			write: func(writer HTTPWriter) {
+				writer.WriteHeader(204)
+				writer.Write([]byte("ignored"))
+			},
+			expectedWrite: "HTTP/1.1 204 No Content\r\nConnection: keep-alive\r\n\r\n",
+		},
+		{
+			name:      "only the first status counts",
+			proto:     "HTTP/1.1",
+			keepAlive: true,
+			write: func(writer HTTPWriter) {
+				writer.Write([]byte("OK"))
+				writer.WriteHeader(500)
+				writer.Response("ignored", 500)
+			},
+			expectedWrite: "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: keep-alive\r\n\r\nOK",
+		},
+		{
+			name:      "HEAD keeps the content length but drops the body",
+			method:    Head,
+			proto:     "HTTP/1.1",
+			keepAlive: true,
+			write: func(writer HTTPWriter) {
+				writer.Write([]byte("Hello "))
+				writer.Write([]byte(large))
+			},
+			expectedWrite: fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Length: %d\r\nConnection: keep-alive\r\n\r\n", len(large)+6),
+		},
+		{
+			name:      "HEAD through Response",
+			method:    Head,
+			proto:     "HTTP/1.1",
+			keepAlive: true,
+			write: func(writer HTTPWriter) {
+				writer.Response("Hello", 200)
+			},
+			expectedWrite: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: keep-alive\r\n\r\n",
+		},
+		{
+			name:      "flushed HEAD response",
+			method:    Head,
+			proto:     "HTTP/1.1",
+			keepAlive: true,
+			write: func(writer HTTPWriter) {
+				writer.Write([]byte("Hello"))
+				writer.Flush()
+				writer.Write([]byte(" World"))
+			},
+			expectedWrite: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nConnection: keep-alive\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = Get
+			}
+			mockConn := &mockConnection{}
+			writer := NewHTTPWriter(mockConn, method)
+			writer.SetProto(tt.proto)
+			writer.SetKeepAlive(tt.keepAlive)
+			for _, h := range tt.headers {
+				writer.Header().Add(h.key, h.value)
+			}
+			tt.write(writer)
+			writer.Finish()
+
+			if string(mockConn.written) != tt.expectedWrite {
+				t.Errorf("expected write to be %q but got %q", tt.expectedWrite, mockConn.written)
+			}
+		})
+	}
+}
+
+func TestHttpWriter_WriteAfterFinish(t *testing.T) {
+	writer := NewHTTPWriter(&mockConnection{}, Get)
+	writer.Response("Hello", 200)
+
+	if _, err := writer.Write([]byte("World")); !errors.Is(err, ErrResponseFinished) {
+		t.Errorf("expected ErrResponseFinished but got %v", err)
+	}
+}
+
+func TestHttpWriter_Reset(t *testing.T) {
+	tests := []struct {
+		name          string
+		write         func(writer HTTPWriter)
+		expectedWrite string
+	}{
+		{
+			name: "held back response is replaced",
+			write: func(writer HTTPWriter) {
+				writer.Header().Set(ContentType, "application/json")
+				writer.WriteHeader(201)
+				writer.Write([]byte("partial"))
+			},
+			expectedWrite: "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 6\r\n\r\nfailed",
+		},
+		{
+			name: "sent headers stay",
+			write: func(writer HTTPWriter) {
+				writer.Write([]byte("streamed"))
+				writer.Flush()
+			},
+			expectedWrite: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n8\r\nstreamed\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &mockConnection{}
+			writer := NewHTTPWriter(conn, Get)
+			tt.write(writer)
+
+			headerSent := writer.HeaderSent()
+			writer.Reset()
+			if !headerSent {
+				writer.Response("failed", 500)
+			}
+
+			if string(conn.written) != tt.expectedWrite {
+				t.Errorf("expected %q but got %q", tt.expectedWrite, conn.written)
+			}
+		})
+	}
+}
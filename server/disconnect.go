@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrClientDisconnected is the cause of a request's context when the client closed the connection
+// while the handler was running.
+var ErrClientDisconnected = errors.New("client disconnected")
+
+// aLongTimeAgo is a read deadline in the past, it makes a pending read on the connection return right away.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// disconnectWatcher cancels a request's context when the client goes away while the handler runs. It does
+// so by reading ahead on the connection, which is only safe once the handler is done with the request body,
+// so it isn't started before that. Whatever it reads stays buffered for the next request.
+type disconnectWatcher struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	cancel context.CancelCauseFunc
+
+	mu      sync.Mutex
+	stopped bool
+	done    chan struct{} // closed once the background read returns, nil until it starts
+}
+
+func (w *disconnectWatcher) start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped || w.done != nil {
+		return
+	}
+
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		// Pipelined requests make the read succeed, a deadline means the read timeout passed or stop was called
+		if _, err := w.reader.Peek(1); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			w.cancel(ErrClientDisconnected)
+		}
+	}()
+}
+
+// stop ends the background read and waits for it, the caller has to reset the read deadline afterwards.
+func (w *disconnectWatcher) stop() {
+	w.mu.Lock()
+	w.stopped = true
+	done := w.done
+	w.mu.Unlock()
+
+	if done == nil {
+		return
+	}
+
+	w.conn.SetReadDeadline(aLongTimeAgo)
+	<-done
+}
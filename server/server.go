@@ -2,16 +2,111 @@ package server
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
+	"net/netip"
 	"os"
 	"os/signal"
-	"strings"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	router2 "github.com/Andreashoj/go-http-server/router"
 )
 
+// DefaultMaxHeaderBytes is used when Server.MaxHeaderBytes is zero.
+const DefaultMaxHeaderBytes = 1 << 20
+
+// minAcceptBackoff and maxAcceptBackoff bound how long Serve waits before accepting again after a temporary error.
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// newConnGracePeriod is how long Shutdown lets a freshly accepted connection send its first request before
+// treating it as idle, its request may already be on the way.
+const newConnGracePeriod = 5 * time.Second
+
+// shutdownPollInterval is how often Shutdown checks whether all connections have gone idle.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// ErrServerClosed is returned by Serve and ListenAndServe once Shutdown or Close has been called.
+var ErrServerClosed = errors.New("server closed")
+
+type connState int
+
+const (
+	stateNew    connState = iota // accepted, waiting for the first request
+	stateActive                  // reading a request or running its handler
+	stateIdle                    // kept alive, waiting for the next request
+)
+
+type trackedConn struct {
+	state connState
+	since time.Time // when it entered state
+}
+
+// Server serves the routes of a router.Router over TCP. A zero timeout means no timeout,
+// NewServer fills in defaults that keep slow or idle clients from holding connections forever.
+type Server struct {
+	Addr   string
+	Router router2.Router
+
+	// ReadHeaderTimeout limits reading the start line and headers, falls back to ReadTimeout when zero.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout limits reading the entire request, including the body.
+	ReadTimeout time.Duration
+	// WriteTimeout limits writing the response, counted from the moment the request is read.
+	WriteTimeout time.Duration
+	// IdleTimeout limits how long a keep-alive connection waits for the next request,
+	// falls back to ReadTimeout when zero.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes caps the size of the start line and headers, DefaultMaxHeaderBytes when zero.
+	MaxHeaderBytes int
+	// TLSConfig is used by ListenAndServeTLS and ServeTLS, certificates passed to those are added to a copy of it.
+	TLSConfig *tls.Config
+	// OnPanic is called when a handler or middleware panics, with the recovered value and the stack trace,
+	// to report it or render a custom error. A 500 is written afterwards if it didn't write a response itself.
+	// When the handler had already sent the headers the connection is closed instead, whatever OnPanic writes.
+	OnPanic func(writer router2.HTTPWriter, request router2.HTTPRequest, recovered any, stack []byte)
+
+	// TrustedProxies are the proxies whose forwarding headers are believed when working out a request's
+	// ClientIP, Scheme and OriginalHost, see router.ResolveClient. With none the headers are ignored.
+	TrustedProxies []netip.Prefix
+	// BaseContext returns the context requests accepted on listener derive theirs from,
+	// context.Background() when nil.
+	BaseContext func(listener net.Listener) context.Context
+
+	// Logger receives the server's diagnostics, slog.Default() when nil.
+	Logger *slog.Logger
+
+	mu           sync.Mutex
+	listeners    map[net.Listener]struct{}
+	conns        map[net.Conn]trackedConn
+	shuttingDown atomic.Bool
+	stopping     context.Context // cancelled with ErrServerClosed by Shutdown and Close
+	stop         context.CancelCauseFunc
+}
+
+func NewServer(addr string, r router2.Router) *Server {
+	return &Server{
+		Addr:              addr,
+		Router:            r,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    DefaultMaxHeaderBytes,
+		Logger:            slog.Default(),
+	}
+}
+
+// StartServer serves r on port until SIGINT or SIGTERM, then drains in-flight requests before returning.
 func StartServer(port string, r router2.Router) error {
 	listener, err := net.Listen("tcp", port)
 
@@ -19,54 +114,504 @@ func StartServer(port string, r router2.Router) error {
 		return fmt.Errorf("Failed creating listener for TCP on port: 8080, with error %s\n", err)
 	}
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+	s := NewServer(port, r)
+	stopped := s.ShutdownOnSignal(30 * time.Second)
+
+	s.logger().Info("server listening", "addr", listener.Addr().String())
+	err = s.Serve(listener)
+	if !errors.Is(err, ErrServerClosed) {
+		return err
+	}
+
+	<-stopped
+	return nil
+}
+
+// ListenAndServe listens on s.Addr and serves incoming connections until the listener fails.
+func (s *Server) ListenAndServe() error {
+	if s.shuttingDown.Load() {
+		return ErrServerClosed
+	}
+
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed creating listener for TCP on %s: %w", s.Addr, err)
+	}
+
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on listener and serves each on its own goroutine. Temporary accept errors,
+// like running out of file descriptors, are retried with a growing delay.
+// It always returns a non-nil error, ErrServerClosed after Shutdown or Close.
+func (s *Server) Serve(listener net.Listener) error {
+	defer listener.Close()
+	if !s.trackListener(listener, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(listener, false)
+
+	ctx := context.Background()
+	if s.BaseContext != nil {
+		ctx = s.BaseContext(listener)
+		if ctx == nil {
+			panic("server: BaseContext returned a nil context")
+		}
+	}
+
+	var backoff time.Duration
+	for {
+		cn, err := listener.Accept()
+		if err != nil {
+			if s.shuttingDown.Load() {
+				return ErrServerClosed
+			}
+
+			// Running out of file descriptors or a client aborting mid-handshake passes, keep accepting
+			if isTemporary(err) {
+				backoff = min(max(2*backoff, minAcceptBackoff), maxAcceptBackoff)
+				s.logger().Error("failed accepting connection, retrying", "error", err, "retry_in", backoff)
+				time.Sleep(backoff)
+				continue
+			}
+
+			return fmt.Errorf("couldn't accept incoming TCP request: %w", err)
+		}
+		backoff = 0
+
+		s.setConnState(cn, stateNew)
+		go s.serveConn(ctx, cn)
+	}
+}
+
+// Shutdown stops accepting connections, closes idle ones and waits for active ones to finish
+// their current request. The contexts of those requests are cancelled so handlers can wrap up early.
+// When ctx expires first, the remaining connections are closed and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+	s.closeListeners()
+	s.cancelRequests()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			s.closeConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close stops the server right away, closing every listener and connection without waiting.
+func (s *Server) Close() error {
+	s.shuttingDown.Store(true)
+	s.closeListeners()
+	s.cancelRequests()
+	s.closeConns()
+
+	return nil
+}
 
+// ShutdownOnSignal calls Shutdown once one of signals arrives, SIGINT and SIGTERM when none are given,
+// giving in-flight requests timeout to finish. The returned channel is closed when Shutdown has returned.
+func (s *Server) ShutdownOnSignal(timeout time.Duration, signals ...os.Signal) <-chan struct{} {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+
+	stopped := make(chan struct{})
 	go func() {
-		for {
-			cn, err := listener.Accept()
-			if err != nil {
-				fmt.Printf("Couldn't accept incoming TCP request with error: %s", err)
+		defer close(stopped)
+		sig := <-received
+		signal.Stop(received)
+
+		s.logger().Info("shutting down server", "signal", sig.String())
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			s.logger().Error("failed shutting down gracefully", "error", err)
+		}
+	}()
+
+	return stopped
+}
+
+// serveConn handles requests on a single connection until the client or a response asks to close it,
+// or the connection has been idle for longer than the idle timeout. Request contexts derive from ctx.
+func (s *Server) serveConn(ctx context.Context, cn net.Conn) {
+	defer s.forgetConn(cn)
+	defer cn.Close()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	defer context.AfterFunc(s.stoppingContext(), func() { cancel(ErrServerClosed) })()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			s.logger().Error("panic serving connection",
+				"remote_addr", cn.RemoteAddr().String(),
+				"panic", recovered,
+				"stack", string(debug.Stack()),
+			)
+		}
+	}()
+
+	// The handshake and the first request share the header timeout from accept, a client that connects and
+	// never sends anything shouldn't get the longer idle timeout meant for keep-alive connections
+	s.setReadDeadline(cn, s.readHeaderTimeout())
+
+	var tlsState *tls.ConnectionState
+	if tlsConn, ok := cn.(*tls.Conn); ok {
+		if err := s.handshake(tlsConn); err != nil {
+			s.logger().Debug("TLS handshake failed", "remote_addr", cn.RemoteAddr().String(), "error", err)
+			return
+		}
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+	}
+
+	reader := bufio.NewReader(cn)
+	for first := true; ; first = false {
+		// Between requests wait for the first byte of the next one under the idle timeout
+		if !first {
+			s.setReadDeadline(cn, s.idleTimeout())
+		}
+		if _, err := reader.Peek(1); err != nil {
+			return // client went away, stayed idle or the server is shutting down
+		}
+		s.setConnState(cn, stateActive)
+
+		started := time.Now()
+		if !first {
+			s.setReadDeadline(cn, s.readHeaderTimeout())
+		}
+		requestCtx, cancelRequest := context.WithCancelCause(ctx)
+		watcher := &disconnectWatcher{conn: cn, reader: reader, cancel: cancelRequest}
+		request, err := router2.ParseWithOptions(reader, router2.ParseOptions{
+			MaxHeaderBytes: s.maxHeaderBytes(),
+			Logger:         s.logger(),
+			OnBodyEOF:      watcher.start,
+		})
+		if err != nil {
+			cancelRequest(nil)
+
+			if errors.Is(err, io.EOF) { // client closed the connection halfway through the request
+				return
 			}
 
-			go func() {
-				defer cn.Close() // Should be disabled if http keep-alive is set
-				reader := bufio.NewReader(cn)
-				request, err := router2.Parse(reader)
-				if err != nil {
-					if strings.Contains(err.Error(), "EOF") { // handles empty requests
-						return
-					}
-
-					fmt.Printf("failed parsing http request: %s", err)
-					return
-				}
+			status, kind := parseErrorStatus(err)
+			s.logger().Info("rejected malformed request",
+				"remote_addr", cn.RemoteAddr().String(),
+				"status", status,
+				"error_kind", kind,
+				"error", err,
+			)
+			s.writeError(cn, status)
+			return
+		}
+		request.SetTLS(tlsState)
+		request.SetRemoteAddr(cn.RemoteAddr())
+		request.SetLocalAddr(cn.LocalAddr())
+		if len(s.TrustedProxies) > 0 {
+			request.SetClient(router2.ResolveClient(request, s.TrustedProxies))
+		}
+		request.WithContext(requestCtx)
 
-				node, err := r.FindMatchingRoute(request)
-				if err != nil {
-					fmt.Printf("failed finding match for route: %s", err)
-					return
-				}
+		// The body is read by the handler, under ReadTimeout counted from the start of the request
+		if s.ReadTimeout > 0 {
+			cn.SetReadDeadline(started.Add(s.ReadTimeout))
+		} else {
+			cn.SetReadDeadline(time.Time{})
+		}
 
-				if node.Route == nil {
-					return
-				}
+		var writeDeadline time.Time
+		if s.WriteTimeout > 0 {
+			writeDeadline = time.Now().Add(s.WriteTimeout)
+			cn.SetWriteDeadline(writeDeadline)
+		}
 
-				request.SetRouterURL(node.Route.Url)
+		keepAlive := s.serveRequest(cn, request, writeDeadline)
+		watcher.stop()
+		cancelRequest(nil)
+		if !keepAlive || s.shuttingDown.Load() {
+			return
+		}
 
-				// Writer
-				writer := router2.NewHTTPWriter(cn, node.Route.Method)
-				middlewares := router2.GetMiddlewares(node)
-				handler := router2.ApplyMiddlewares(writer, request, middlewares, node.Route.Handler)
-				handler()
-			}()
+		// Whatever the handler left of the body sits in front of the next request, discard it
+		if s.ReadTimeout > 0 {
+			cn.SetReadDeadline(started.Add(s.ReadTimeout))
+		} else {
+			s.setReadDeadline(cn, s.idleTimeout())
+		}
+		if err := request.BodyReader().Close(); err != nil {
+			return
+		}
+		cn.SetWriteDeadline(time.Time{})
+		s.setConnState(cn, stateIdle)
+	}
+}
+
+// serveRequest runs the matching route for request and reports whether the connection can be reused.
+// The request's context expires along with the write deadline, when there is one.
+func (s *Server) serveRequest(cn net.Conn, request router2.HTTPRequest, writeDeadline time.Time) (keepAlive bool) {
+	if !writeDeadline.IsZero() {
+		ctx, cancel := context.WithDeadline(request.Context(), writeDeadline)
+		defer cancel()
+		request.WithContext(ctx)
+	}
+
+	node, err := s.Router.FindMatchingRoute(request)
+	if err != nil {
+		node = s.Router.FindFallbackRoute(request)
+	}
+
+	request.SetRouterURL(node.Route.Url)
+
+	// Writer
+	writer := router2.NewHTTPWriter(cn, request.Method())
+	writer.SetKeepAlive(request.KeepAlive() && !s.shuttingDown.Load())
+	writer.SetProto(request.Proto())
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			s.recoverHandler(writer, request, recovered)
+			keepAlive = false
 		}
 	}()
 
-	fmt.Printf("Server listening on %s\n", port)
-	<-done
-	fmt.Printf("Shutting down server...")
-	listener.Close()
+	middlewares := router2.GetMiddlewares(node)
+	handler := router2.ApplyMiddlewares(writer, request, middlewares, node.Route.Handler)
+	handler()
 
-	return nil
+	// A handler that didn't write anything still answers, with an empty 200 like net/http sends
+	if !writer.Written() {
+		writer.WriteHeader(200)
+	}
+	writer.Finish()
+
+	return writer.KeepAlive()
+}
+
+// recoverHandler reports a panic from a handler and makes sure the client still gets a response.
+// The connection is closed afterwards since the handler may have left it in any state.
+func (s *Server) recoverHandler(writer router2.HTTPWriter, request router2.HTTPRequest, recovered any) {
+	stack := debug.Stack()
+	s.logger().Error("panic serving request",
+		"method", string(request.Method()),
+		"path", request.Url(),
+		"panic", recovered,
+		"stack", string(stack),
+	)
+
+	// Whatever the handler left held back is dropped, a half-written response shouldn't go out as a success.
+	// Once the headers are out only closing the connection, without ending the body, tells the client.
+	headerSent := writer.HeaderSent()
+	writer.Reset()
+	writer.SetKeepAlive(false)
+	if s.OnPanic != nil {
+		func() {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					s.logger().Error("panic in OnPanic", "panic", recovered)
+				}
+			}()
+			s.OnPanic(writer, request, recovered, stack)
+		}()
+	}
+
+	if headerSent {
+		return
+	}
+
+	if !writer.Written() {
+		writer.Header().Add(router2.ContentType, "text/plain; charset=utf-8")
+		writer.Response("Internal Server Error", 500)
+	}
+
+	// What OnPanic wrote is still held back by the writer
+	writer.Finish()
+}
+
+// parseErrorStatus picks the status code answering a request router.Parse rejected,
+// along with a short kind to log it under.
+func parseErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return 408, "timeout"
+	case errors.Is(err, router2.ErrURITooLong):
+		return 414, "uri_too_long"
+	case errors.Is(err, router2.ErrHeaderTooLarge):
+		return 431, "header_too_large"
+	case errors.Is(err, router2.ErrUnsupportedVersion):
+		return 505, "unsupported_version"
+	case errors.Is(err, router2.ErrUnsupportedTransferEncoding):
+		return 501, "unsupported_transfer_encoding"
+	default:
+		return 400, "malformed"
+	}
+}
+
+// writeError answers with a bare status code and closes the connection afterwards.
+func (s *Server) writeError(cn net.Conn, statusCode int) {
+	if s.WriteTimeout > 0 {
+		cn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+
+	writer := router2.NewHTTPWriter(cn, "")
+	writer.SetKeepAlive(false)
+	writer.Response("", statusCode)
+}
+
+// trackListener adds or removes listener from the set Shutdown closes, refusing new ones once shutting down.
+func (s *Server) trackListener(listener net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.listeners, listener)
+		return true
+	}
+
+	if s.shuttingDown.Load() {
+		return false
+	}
+
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[listener] = struct{}{}
+
+	return true
+}
+
+func (s *Server) closeListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for listener := range s.listeners {
+		listener.Close()
+	}
+}
+
+func (s *Server) setConnState(cn net.Conn, state connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]trackedConn)
+	}
+	s.conns[cn] = trackedConn{state: state, since: time.Now()}
+}
+
+func (s *Server) forgetConn(cn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, cn)
+}
+
+// closeIdleConns closes connections that aren't serving a request and reports whether none are left.
+// New connections get newConnGracePeriod to start their first request first.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for cn, tracked := range s.conns {
+		switch {
+		case tracked.state == stateIdle:
+			cn.Close()
+		case tracked.state == stateNew && time.Since(tracked.since) > newConnGracePeriod:
+			cn.Close()
+		}
+	}
+
+	return len(s.conns) == 0
+}
+
+// stoppingContext returns the context Shutdown and Close cancel, request contexts are cancelled along with it.
+func (s *Server) stoppingContext() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopping == nil {
+		s.stopping, s.stop = context.WithCancelCause(context.Background())
+	}
+
+	return s.stopping
+}
+
+func (s *Server) cancelRequests() {
+	s.stoppingContext()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop(ErrServerClosed)
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for cn := range s.conns {
+		cn.Close()
+	}
+}
+
+// isTemporary reports whether an Accept error is likely to go away, like EMFILE or ECONNABORTED.
+func isTemporary(err error) bool {
+	if errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var temporary interface{ Temporary() bool } // EMFILE, ENFILE, EINTR and timeouts
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+func (s *Server) setReadDeadline(cn net.Conn, timeout time.Duration) {
+	if timeout <= 0 {
+		cn.SetReadDeadline(time.Time{})
+		return
+	}
+
+	cn.SetReadDeadline(time.Now().Add(timeout))
+}
+
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout > 0 {
+		return s.ReadHeaderTimeout
+	}
+
+	return s.ReadTimeout
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+
+	return s.ReadTimeout
+}
+
+func (s *Server) maxHeaderBytes() int {
+	if s.MaxHeaderBytes > 0 {
+		return s.MaxHeaderBytes
+	}
+
+	return DefaultMaxHeaderBytes
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+
+	return s.Logger
 }
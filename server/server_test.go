@@ -0,0 +1,1111 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	router2 "github.com/Andreashoj/go-http-server/router"
+)
+
+func newTestServer() *Server {
+	r := router2.NewRouter()
+	r.Get("/hello", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+		writer.Response("Hello", 200)
+	})
+
+	s := NewServer("", r)
+	s.Logger = slog.New(slog.DiscardHandler)
+	return s
+}
+
+// servePipe serves s on one end of an in-memory connection and returns the client end.
+func servePipe(t *testing.T, s *Server) (net.Conn, chan struct{}) {
+	t.Helper()
+	client, conn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.serveConn(context.Background(), conn)
+		close(done)
+	}()
+	t.Cleanup(func() { client.Close() })
+
+	return client, done
+}
+
+func waitClosed(t *testing.T, done chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected connection to be closed")
+	}
+}
+
+func TestServer_KeepAlive(t *testing.T) {
+	tests := []struct {
+		name             string
+		requests         string
+		expectedResponse string
+	}{
+		{
+			name:     "HTTP/1.1 keeps the connection open until asked to close",
+			requests: "GET /hello HTTP/1.1\r\nHost: example.com\r\n\r\nGET /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: keep-alive\r\n\r\nHello" +
+				"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello",
+		},
+		{
+			name:             "HTTP/1.0 closes after the first response",
+			requests:         "GET /hello HTTP/1.0\r\nHost: example.com\r\n\r\nGET /hello HTTP/1.0\r\nHost: example.com\r\n\r\n",
+			expectedResponse: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello",
+		},
+		{
+			name:     "HTTP/1.0 with keep-alive",
+			requests: "GET /hello HTTP/1.0\r\nHost: example.com\r\nConnection: keep-alive\r\n\r\nGET /hello HTTP/1.0\r\nHost: example.com\r\n\r\n",
+			expectedResponse: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: keep-alive\r\n\r\nHello" +
+				"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, done := servePipe(t, newTestServer())
+			go client.Write([]byte(tt.requests))
+
+			client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			response, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatalf("failed reading response: %s", err)
+			}
+
+			if string(response) != tt.expectedResponse {
+				t.Errorf("expected response %q but got %q", tt.expectedResponse, response)
+			}
+			waitClosed(t, done)
+		})
+	}
+}
+
+func TestServer_RequestBody(t *testing.T) {
+	tests := []struct {
+		name             string
+		requests         string
+		expectedResponse string
+	}{
+		{
+			name:             "streamed body",
+			requests:         "POST /echo HTTP/1.1\r\nHost: example.com\r\nContent-Length: 11\r\nConnection: close\r\n\r\nHello World",
+			expectedResponse: "HTTP/1.1 200 OK\r\nContent-Length: 11\r\nConnection: close\r\n\r\nHello World",
+		},
+		{
+			name: "chunked body",
+			requests: "POST /echo HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"5\r\nHello\r\n6;ext=1\r\n World\r\n0\r\n\r\n" +
+				"GET /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 200 OK\r\nContent-Length: 11\r\nConnection: keep-alive\r\n\r\nHello World" +
+				"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello",
+		},
+		{
+			name: "unread chunked body is discarded before the next request",
+			requests: "POST /ignore HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"5\r\nHello\r\n0\r\nChecksum: abc\r\n\r\n" +
+				"GET /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 204 No Content\r\nConnection: keep-alive\r\n\r\n" +
+				"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello",
+		},
+		{
+			name: "unread body is discarded before the next request",
+			requests: "POST /ignore HTTP/1.1\r\nHost: example.com\r\nContent-Length: 11\r\n\r\nHello World" +
+				"GET /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 204 No Content\r\nConnection: keep-alive\r\n\r\n" +
+				"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello",
+		},
+		{
+			name: "partially read body is discarded before the next request",
+			requests: "POST /partial HTTP/1.1\r\nHost: example.com\r\nContent-Length: 11\r\n\r\nHello World" +
+				"GET /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: keep-alive\r\n\r\nHello" +
+				"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.Router.Post("/echo", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+				var body strings.Builder
+				chunk := make([]byte, 4)
+				for {
+					n, err := request.BodyReader().Read(chunk)
+					body.Write(chunk[:n])
+					if err != nil {
+						break
+					}
+				}
+				writer.Response(body.String(), 200)
+			})
+			s.Router.Post("/ignore", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+				writer.Response("", 204)
+			})
+			s.Router.Post("/partial", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+				chunk := make([]byte, 5)
+				io.ReadFull(request.BodyReader(), chunk)
+				writer.Response(string(chunk), 200)
+			})
+			client, done := servePipe(t, s)
+			go client.Write([]byte(tt.requests))
+
+			client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			response, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatalf("failed reading response: %s", err)
+			}
+
+			if string(response) != tt.expectedResponse {
+				t.Errorf("expected response %q but got %q", tt.expectedResponse, response)
+			}
+			waitClosed(t, done)
+		})
+	}
+}
+
+func TestServer_StreamingResponse(t *testing.T) {
+	s := newTestServer()
+	s.Router.Get("/stream", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(writer, "line %d\n", i)
+			writer.Flush()
+		}
+	})
+	client, done := servePipe(t, s)
+	go client.Write([]byte("GET /stream HTTP/1.1\r\nHost: example.com\r\n\r\nGET /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("failed reading response: %s", err)
+	}
+
+	expected := "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nConnection: keep-alive\r\n\r\n" +
+		"7\r\nline 1\n\r\n7\r\nline 2\n\r\n7\r\nline 3\n\r\n0\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello"
+	if string(response) != expected {
+		t.Errorf("expected response %q but got %q", expected, response)
+	}
+	waitClosed(t, done)
+}
+
+func TestServer_Timeouts(t *testing.T) {
+	t.Run("idle connection is closed", func(t *testing.T) {
+		s := newTestServer()
+		s.IdleTimeout = 50 * time.Millisecond
+		client, done := servePipe(t, s)
+		go io.Copy(io.Discard, client)
+		client.Write([]byte("GET /hello HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+
+		waitClosed(t, done)
+	})
+
+	t.Run("client that never sends anything hits the header timeout", func(t *testing.T) {
+		s := newTestServer()
+		s.ReadHeaderTimeout = 50 * time.Millisecond
+		s.IdleTimeout = time.Minute
+		_, done := servePipe(t, s)
+
+		waitClosed(t, done)
+	})
+
+	t.Run("slow headers get a 408", func(t *testing.T) {
+		s := newTestServer()
+		s.ReadHeaderTimeout = 50 * time.Millisecond
+		client, done := servePipe(t, s)
+		go client.Write([]byte("GET /hello HTTP/1.1\r\n"))
+
+		client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		response, err := io.ReadAll(client)
+		if err != nil {
+			t.Fatalf("failed reading response: %s", err)
+		}
+
+		expected := "HTTP/1.1 408 Request Timeout\r\nConnection: close\r\n\r\n"
+		if string(response) != expected {
+			t.Errorf("expected response %q but got %q", expected, response)
+		}
+		waitClosed(t, done)
+	})
+
+	t.Run("slow body times out the handler's read", func(t *testing.T) {
+		s := newTestServer()
+		s.ReadTimeout = 50 * time.Millisecond
+		s.Router.Post("/upload", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+			_, err := io.ReadAll(request.BodyReader())
+			writer.Response(fmt.Sprint(errors.Is(err, os.ErrDeadlineExceeded)), 200)
+		})
+		client, done := servePipe(t, s)
+		go client.Write([]byte("POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Length: 10\r\n\r\nabc"))
+
+		client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		response, err := io.ReadAll(client)
+		if err != nil {
+			t.Fatalf("failed reading response: %s", err)
+		}
+
+		// The body can't be drained anymore, so the connection is closed despite the keep-alive
+		if !strings.HasSuffix(string(response), "true") {
+			t.Errorf("expected the handler to see the read deadline but got %q", response)
+		}
+		waitClosed(t, done)
+	})
+
+	t.Run("client that doesn't read hits the write timeout", func(t *testing.T) {
+		s := newTestServer()
+		s.WriteTimeout = 50 * time.Millisecond
+		client, done := servePipe(t, s)
+		client.Write([]byte("GET /hello HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+
+		waitClosed(t, done)
+	})
+}
+
+func TestServer_ErrorResponses(t *testing.T) {
+	tests := []struct {
+		name             string
+		request          string
+		expectedResponse string
+	}{
+		{
+			name:             "malformed request",
+			request:          "GET /hello\r\nHost: example.com\r\n\r\n",
+			expectedResponse: "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:             "missing host header",
+			request:          "GET /hello HTTP/1.1\r\n\r\n",
+			expectedResponse: "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:             "start line over the limit",
+			request:          "GET /" + strings.Repeat("a", 128) + " HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			expectedResponse: "HTTP/1.1 414 URI Too Long\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:             "headers over the limit",
+			request:          "GET /hello HTTP/1.1\r\nHost: example.com\r\nX-Padding: " + strings.Repeat("a", 128) + "\r\n\r\n",
+			expectedResponse: "HTTP/1.1 431 Request Header Fields Too Large\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:             "unsupported version",
+			request:          "GET /hello HTTP/2.0\r\nHost: example.com\r\n\r\n",
+			expectedResponse: "HTTP/1.1 505 HTTP Version Not Supported\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:             "both transfer encoding and content length",
+			request:          "POST /hello HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\n",
+			expectedResponse: "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:             "unsupported transfer encoding",
+			request:          "POST /hello HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: gzip\r\n\r\n",
+			expectedResponse: "HTTP/1.1 501 Not Implemented\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:             "unknown path",
+			request:          "GET /nonexistent HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 404 Not Found\r\nContent-Length: 9\r\nConnection: close\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nNot Found",
+		},
+		{
+			name:             "path registered under another method",
+			request:          "POST /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 405 Method Not Allowed\r\nContent-Length: 18\r\nConnection: close\r\nAllow: GET, HEAD, OPTIONS\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nMethod Not Allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.MaxHeaderBytes = 100
+			client, done := servePipe(t, s)
+			go client.Write([]byte(tt.request))
+
+			client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			response, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatalf("failed reading response: %s", err)
+			}
+
+			if string(response) != tt.expectedResponse {
+				t.Errorf("expected response %q but got %q", tt.expectedResponse, response)
+			}
+			waitClosed(t, done)
+		})
+	}
+}
+
+func TestServer_AutomaticHeadAndOptions(t *testing.T) {
+	tests := []struct {
+		name             string
+		request          string
+		expectedResponse string
+	}{
+		{
+			name:             "HEAD runs the GET handler without the body",
+			request:          "HEAD /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:             "explicit HEAD handler wins",
+			request:          "HEAD /custom HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 200 OK\r\nConnection: close\r\nX-Handler: head\r\n\r\n",
+		},
+		{
+			name:             "OPTIONS lists the allowed methods",
+			request:          "OPTIONS /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 204 No Content\r\nConnection: close\r\nAllow: GET, HEAD, OPTIONS\r\n\r\n",
+		},
+		{
+			name:             "explicit OPTIONS handler wins",
+			request:          "OPTIONS /custom HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 200 OK\r\nContent-Length: 7\r\nConnection: close\r\n\r\noptions",
+		},
+		{
+			name:             "OPTIONS on an unknown path",
+			request:          "OPTIONS /nonexistent HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n",
+			expectedResponse: "HTTP/1.1 404 Not Found\r\nContent-Length: 9\r\nConnection: close\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nNot Found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.Router.Get("/custom", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+				writer.Response("get", 200)
+			})
+			s.Router.Head("/custom", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+				writer.Header().Set("X-Handler", "head")
+				writer.WriteHeader(200)
+			})
+			s.Router.Options("/custom", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+				writer.Response("options", 200)
+			})
+			client, done := servePipe(t, s)
+			go client.Write([]byte(tt.request))
+
+			client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			response, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatalf("failed reading response: %s", err)
+			}
+
+			if string(response) != tt.expectedResponse {
+				t.Errorf("expected response %q but got %q", tt.expectedResponse, response)
+			}
+			waitClosed(t, done)
+		})
+	}
+}
+
+func TestServer_NotFoundMiddlewares(t *testing.T) {
+	s := newTestServer()
+	s.Router.Use(func(writer router2.HTTPWriter, request router2.HTTPRequest, next func()) {
+		writer.Header().Add("X-Middleware", "ran")
+		next()
+	})
+	s.Router.NotFound(func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+		writer.Response("nothing here", 404)
+	})
+	client, _ := servePipe(t, s)
+	go client.Write([]byte("GET /nonexistent HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("failed reading response: %s", err)
+	}
+
+	expected := "HTTP/1.1 404 Not Found\r\nContent-Length: 12\r\nConnection: close\r\nX-Middleware: ran\r\n\r\nnothing here"
+	if string(response) != expected {
+		t.Errorf("expected response %q but got %q", expected, response)
+	}
+}
+
+func TestServer_Serve(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed creating listener: %s", err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- newTestServer().Serve(listener)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed dialing server: %s", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("failed reading response: %s", err)
+	}
+
+	expected := "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello"
+	if string(response) != expected {
+		t.Errorf("expected response %q but got %q", expected, response)
+	}
+
+	listener.Close()
+	if err := <-served; err == nil {
+		t.Errorf("expected Serve to return an error once the listener is closed")
+	}
+}
+
+// startServer serves s on a loopback listener and returns its address and the result of Serve.
+func startServer(t *testing.T, s *Server) (string, chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed creating listener: %s", err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(listener)
+	}()
+	t.Cleanup(func() { s.Close() })
+
+	return listener.Addr().String(), served
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	t.Run("waits for in-flight requests", func(t *testing.T) {
+		s := newTestServer()
+		started := make(chan struct{})
+		release := make(chan struct{})
+		s.Router.Get("/slow", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+			close(started)
+			<-release
+			writer.Response("Done", 200)
+		})
+		addr, served := startServer(t, s)
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed dialing server: %s", err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+		<-started
+
+		shutdown := make(chan error, 1)
+		go func() {
+			shutdown <- s.Shutdown(context.Background())
+		}()
+
+		select {
+		case err := <-shutdown:
+			t.Fatalf("expected Shutdown to wait for the handler but it returned %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("failed reading response: %s", err)
+		}
+
+		// ReadAll only returns once the server closed the connection after the response
+		if !strings.HasPrefix(string(response), "HTTP/1.1 200 OK") || !strings.HasSuffix(string(response), "Done") {
+			t.Errorf("expected the handler's response but got %q", response)
+		}
+
+		if err := <-shutdown; err != nil {
+			t.Errorf("expected Shutdown to succeed but got %s", err)
+		}
+
+		if err := <-served; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("expected Serve to return ErrServerClosed but got %v", err)
+		}
+	})
+
+	t.Run("serves the first request of a just accepted connection", func(t *testing.T) {
+		s := newTestServer()
+		addr, _ := startServer(t, s)
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed dialing server: %s", err)
+		}
+		defer conn.Close()
+
+		// Wait for the server to track the connection before its request goes out
+		for deadline := time.Now().Add(2 * time.Second); ; {
+			s.mu.Lock()
+			tracked := len(s.conns)
+			s.mu.Unlock()
+			if tracked == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the connection to be accepted")
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		shutdown := make(chan error, 1)
+		go func() {
+			shutdown <- s.Shutdown(context.Background())
+		}()
+		time.Sleep(3 * shutdownPollInterval)
+
+		conn.Write([]byte("GET /hello HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("failed reading response: %s", err)
+		}
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello"
+		if string(response) != expected {
+			t.Errorf("expected response %q but got %q", expected, response)
+		}
+
+		if err := <-shutdown; err != nil {
+			t.Errorf("expected Shutdown to succeed but got %s", err)
+		}
+	})
+
+	t.Run("closes idle keep-alive connections", func(t *testing.T) {
+		s := newTestServer()
+		addr, _ := startServer(t, s)
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed dialing server: %s", err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("GET /hello HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+
+		reader := bufio.NewReader(conn)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := reader.ReadString('\n'); err != nil {
+			t.Fatalf("failed reading response: %s", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			t.Errorf("expected Shutdown to succeed but got %s", err)
+		}
+	})
+
+	t.Run("force closes connections when the context expires", func(t *testing.T) {
+		s := newTestServer()
+		started := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		s.Router.Get("/stuck", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+			close(started)
+			<-release
+		})
+		addr, _ := startServer(t, s)
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed dialing server: %s", err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("GET /stuck HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected Shutdown to fail with context.DeadlineExceeded but got %v", err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := io.ReadAll(conn); err != nil {
+			t.Errorf("expected the connection to be closed but got %s", err)
+		}
+	})
+
+	t.Run("refuses to serve after shutdown", func(t *testing.T) {
+		s := newTestServer()
+		s.Shutdown(context.Background())
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed creating listener: %s", err)
+		}
+
+		if err := s.Serve(listener); !errors.Is(err, ErrServerClosed) {
+			t.Errorf("expected Serve to return ErrServerClosed but got %v", err)
+		}
+	})
+}
+
+func TestServer_PanicRecovery(t *testing.T) {
+	tests := []struct {
+		name             string
+		path             string
+		onPanic          func(writer router2.HTTPWriter, request router2.HTTPRequest, recovered any, stack []byte)
+		expectedResponse string
+	}{
+		{
+			name:             "default 500",
+			expectedResponse: "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 21\r\nConnection: close\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nInternal Server Error",
+		},
+		{
+			name: "OnPanic renders its own response",
+			onPanic: func(writer router2.HTTPWriter, request router2.HTTPRequest, recovered any, stack []byte) {
+				writer.Response(fmt.Sprintf(`{"error":"%v"}`, recovered), 500)
+			},
+			expectedResponse: "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 16\r\nConnection: close\r\n\r\n{\"error\":\"boom\"}",
+		},
+		{
+			name: "OnPanic writes its own status and body",
+			onPanic: func(writer router2.HTTPWriter, request router2.HTTPRequest, recovered any, stack []byte) {
+				writer.Header().Set(router2.ContentType, "application/json")
+				writer.WriteHeader(503)
+				writer.Write([]byte(`{"error":"unavailable"}`))
+			},
+			expectedResponse: "HTTP/1.1 503 Service Unavailable\r\nContent-Length: 23\r\nConnection: close\r\nContent-Type: application/json\r\n\r\n{\"error\":\"unavailable\"}",
+		},
+		{
+			name:             "handler wrote before panicking",
+			path:             "/partial",
+			expectedResponse: "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 21\r\nConnection: close\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nInternal Server Error",
+		},
+		{
+			name: "OnPanic replaces what the handler wrote",
+			path: "/partial",
+			onPanic: func(writer router2.HTTPWriter, request router2.HTTPRequest, recovered any, stack []byte) {
+				writer.Response("failed", 500)
+			},
+			expectedResponse: "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 6\r\nConnection: close\r\n\r\nfailed",
+		},
+		{
+			name:             "handler panicking mid-stream leaves the chunked body unterminated",
+			path:             "/streaming",
+			expectedResponse: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nConnection: keep-alive\r\n\r\n8\r\nstreamed\r\n",
+		},
+		{
+			name: "OnPanic only reports",
+			onPanic: func(writer router2.HTTPWriter, request router2.HTTPRequest, recovered any, stack []byte) {
+				if len(stack) == 0 {
+					panic("expected a stack trace")
+				}
+			},
+			expectedResponse: "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 21\r\nConnection: close\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nInternal Server Error",
+		},
+		{
+			name: "OnPanic panicking itself",
+			onPanic: func(writer router2.HTTPWriter, request router2.HTTPRequest, recovered any, stack []byte) {
+				panic("again")
+			},
+			expectedResponse: "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 21\r\nConnection: close\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nInternal Server Error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.OnPanic = tt.onPanic
+			s.Router.Use(func(writer router2.HTTPWriter, request router2.HTTPRequest, next func()) {
+				next()
+			})
+			s.Router.Get("/panic", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+				panic("boom")
+			})
+			s.Router.Get("/partial", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+				writer.Header().Set(router2.ContentType, "application/json")
+				writer.WriteHeader(201)
+				writer.Write([]byte("partial"))
+				panic("boom")
+			})
+			s.Router.Get("/streaming", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+				writer.Write([]byte("streamed"))
+				writer.Flush()
+				panic("boom")
+			})
+			path := tt.path
+			if path == "" {
+				path = "/panic"
+			}
+			client, done := servePipe(t, s)
+			go client.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+
+			client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			response, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatalf("failed reading response: %s", err)
+			}
+
+			if string(response) != tt.expectedResponse {
+				t.Errorf("expected response %q but got %q", tt.expectedResponse, response)
+			}
+			waitClosed(t, done)
+		})
+	}
+}
+
+func TestServer_StructuredLogging(t *testing.T) {
+	var logs bytes.Buffer
+	s := newTestServer()
+	s.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	client, done := servePipe(t, s)
+	go client.Write([]byte("GET /hello HTTP/2.0\r\nHost: example.com\r\n\r\n"))
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	io.ReadAll(client)
+	waitClosed(t, done)
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON log line but got %q: %s", logs.String(), err)
+	}
+
+	expected := map[string]any{
+		"level":       "INFO",
+		"msg":         "rejected malformed request",
+		"remote_addr": "pipe",
+		"status":      float64(505),
+		"error_kind":  "unsupported_version",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("expected log field %s to be %v but got %v", key, value, entry[key])
+		}
+	}
+}
+
+func TestServer_RequestContext(t *testing.T) {
+	// waitDone is a handler that blocks until its context ends and reports the cause
+	waitDone := func(started chan struct{}, causes chan error) func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+		return func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+			request.Body()
+			close(started)
+			select {
+			case <-request.Context().Done():
+				causes <- context.Cause(request.Context())
+			case <-time.After(2 * time.Second):
+				causes <- nil
+			}
+			writer.Response("Done", 200)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		request       string
+		expectedCause error
+	}{
+		{
+			name:          "without a body",
+			request:       "GET /wait HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			expectedCause: ErrClientDisconnected,
+		},
+		{
+			name:          "after reading the body",
+			request:       "POST /wait HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nHello",
+			expectedCause: ErrClientDisconnected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("client disconnect "+tt.name, func(t *testing.T) {
+			started, causes := make(chan struct{}), make(chan error, 1)
+			s := newTestServer()
+			s.Router.Get("/wait", waitDone(started, causes))
+			s.Router.Post("/wait", waitDone(started, causes))
+			client, done := servePipe(t, s)
+
+			go client.Write([]byte(tt.request))
+			<-started
+			client.Close()
+
+			if cause := <-causes; !errors.Is(cause, tt.expectedCause) {
+				t.Errorf("expected the context to end with %v but got %v", tt.expectedCause, cause)
+			}
+			waitClosed(t, done)
+		})
+	}
+
+	t.Run("write timeout", func(t *testing.T) {
+		started, causes := make(chan struct{}), make(chan error, 1)
+		s := newTestServer()
+		s.WriteTimeout = 50 * time.Millisecond
+		s.Router.Get("/wait", waitDone(started, causes))
+		client, _ := servePipe(t, s)
+
+		go client.Write([]byte("GET /wait HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+		if cause := <-causes; !errors.Is(cause, context.DeadlineExceeded) {
+			t.Errorf("expected the context to end with %v but got %v", context.DeadlineExceeded, cause)
+		}
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		started, causes := make(chan struct{}), make(chan error, 1)
+		s := newTestServer()
+		s.Router.Get("/wait", waitDone(started, causes))
+		addr, _ := startServer(t, s)
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed dialing server: %s", err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("GET /wait HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+		<-started
+
+		if err := s.Shutdown(context.Background()); err != nil {
+			t.Errorf("expected Shutdown to succeed but got %s", err)
+		}
+
+		if cause := <-causes; !errors.Is(cause, ErrServerClosed) {
+			t.Errorf("expected the context to end with %v but got %v", ErrServerClosed, cause)
+		}
+	})
+
+	t.Run("base context and cancel once served", func(t *testing.T) {
+		type key struct{}
+		contexts := make(chan context.Context, 2)
+		s := newTestServer()
+		s.BaseContext = func(listener net.Listener) context.Context {
+			return context.WithValue(context.Background(), key{}, "base")
+		}
+		s.Router.Get("/ctx", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+			contexts <- request.Context()
+			writer.Response("", 204)
+		})
+		addr, _ := startServer(t, s)
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("failed dialing server: %s", err)
+		}
+		defer conn.Close()
+		conn.Write([]byte("GET /ctx HTTP/1.1\r\nHost: example.com\r\n\r\nGET /ctx HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("failed reading response: %s", err)
+		}
+
+		if strings.Count(string(response), "HTTP/1.1 204 No Content") != 2 {
+			t.Errorf("expected both pipelined requests to be answered but got %q", response)
+		}
+
+		for range 2 {
+			ctx := <-contexts
+			if ctx.Value(key{}) != "base" {
+				t.Errorf("expected the request context to derive from the base context")
+			}
+
+			if ctx.Err() == nil {
+				t.Errorf("expected the request context to be cancelled once the handler returned")
+			}
+		}
+	})
+}
+
+func TestServer_ConnectionMetadata(t *testing.T) {
+	s := newTestServer()
+	requests := make(chan router2.HTTPRequest, 1)
+	s.Router.Get("/whoami", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+		requests <- request
+		writer.Response("", 204)
+	})
+	addr, _ := startServer(t, s)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed dialing server: %s", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /whoami?verbose=1 HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+
+	request := <-requests
+	if request.RemoteAddr() == nil || request.RemoteAddr().String() != conn.LocalAddr().String() {
+		t.Errorf("expected remote address %s but got %v", conn.LocalAddr(), request.RemoteAddr())
+	}
+
+	if request.LocalAddr() == nil || request.LocalAddr().String() != addr {
+		t.Errorf("expected local address %s but got %v", addr, request.LocalAddr())
+	}
+
+	if request.StartLine() != "GET /whoami?verbose=1 HTTP/1.1" || request.RequestURI() != "/whoami?verbose=1" {
+		t.Errorf("expected the raw request line but got %q and %q", request.StartLine(), request.RequestURI())
+	}
+
+	if request.Host() != "example.com" || request.Proto() != "HTTP/1.1" {
+		t.Errorf("expected host example.com over HTTP/1.1 but got %q over %q", request.Host(), request.Proto())
+	}
+}
+
+func TestServer_TrustedProxies(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []netip.Prefix
+		expectedIP     string
+		expectedScheme string
+	}{
+		{
+			name:           "headers from a trusted proxy",
+			trustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "https",
+		},
+		{
+			name:           "headers are ignored without trusted proxies",
+			expectedIP:     "127.0.0.1",
+			expectedScheme: "http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			s.TrustedProxies = tt.trustedProxies
+			requests := make(chan router2.HTTPRequest, 1)
+			s.Router.Get("/ip", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+				requests <- request
+				writer.Response("", 204)
+			})
+			addr, _ := startServer(t, s)
+
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatalf("failed dialing server: %s", err)
+			}
+			defer conn.Close()
+			conn.Write([]byte("GET /ip HTTP/1.1\r\nHost: example.com\r\nX-Forwarded-For: 203.0.113.7\r\nX-Forwarded-Proto: https\r\nConnection: close\r\n\r\n"))
+
+			request := <-requests
+			if request.ClientIP().String() != tt.expectedIP || request.Scheme() != tt.expectedScheme {
+				t.Errorf("expected %s over %s but got %s over %s", tt.expectedIP, tt.expectedScheme, request.ClientIP(), request.Scheme())
+			}
+		})
+	}
+}
+
+func TestServer_ImplicitResponse(t *testing.T) {
+	s := newTestServer()
+	s.Router.Post("/silent", func(writer router2.HTTPWriter, request router2.HTTPRequest) {})
+	client, done := servePipe(t, s)
+	go client.Write([]byte("POST /silent HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+		"GET /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("failed reading response: %s", err)
+	}
+
+	// The empty 200 keeps the connection usable for the next request
+	expected := "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: keep-alive\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nHello"
+	if string(response) != expected {
+		t.Errorf("expected response %q but got %q", expected, response)
+	}
+	waitClosed(t, done)
+}
+
+// flakyListener fails its first Accept calls with errs before handing over to the wrapped listener.
+type flakyListener struct {
+	net.Listener
+	errs []error
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if len(l.errs) > 0 {
+		err := l.errs[0]
+		l.errs = l.errs[1:]
+		return nil, err
+	}
+
+	return l.Listener.Accept()
+}
+
+func TestServer_ServeRetriesTemporaryErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		expectServing bool
+	}{
+		{
+			name:          "too many open files",
+			err:           &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)},
+			expectServing: true,
+		},
+		{
+			name:          "connection aborted",
+			err:           &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.ECONNABORTED)},
+			expectServing: true,
+		},
+		{
+			name:          "permanent error",
+			err:           errors.New("listener broke"),
+			expectServing: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed creating listener: %s", err)
+			}
+			s := newTestServer()
+			t.Cleanup(func() { s.Close() })
+
+			served := make(chan error, 1)
+			go func() {
+				served <- s.Serve(&flakyListener{Listener: listener, errs: []error{tt.err, tt.err, tt.err}})
+			}()
+
+			if !tt.expectServing {
+				select {
+				case err := <-served:
+					if !errors.Is(err, tt.err) {
+						t.Errorf("expected Serve to return %v but got %v", tt.err, err)
+					}
+				case <-time.After(2 * time.Second):
+					t.Errorf("expected Serve to give up on a permanent error")
+				}
+				return
+			}
+
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatalf("failed dialing server: %s", err)
+			}
+			defer conn.Close()
+
+			conn.Write([]byte("GET /hello HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			response, err := io.ReadAll(conn)
+			if err != nil || !strings.HasSuffix(string(response), "Hello") {
+				t.Errorf("expected the server to keep serving after %v but got %q, %v", tt.err, response, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ListenAndServeTLS listens on s.Addr and serves HTTPS. The certificate and key files are watched by a
+// CertReloader, so rotated files are picked up without a restart. Both may be empty when s.TLSConfig
+// already provides certificates.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	if s.shuttingDown.Load() {
+		return ErrServerClosed
+	}
+
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed creating listener for TCP on %s: %w", s.Addr, err)
+	}
+
+	return s.ServeTLS(listener, certFile, keyFile)
+}
+
+// ServeTLS wraps listener with TLS and serves it like Serve does.
+func (s *Server) ServeTLS(listener net.Listener, certFile, keyFile string) error {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+
+	if certFile != "" || keyFile != "" {
+		reloader, err := NewCertReloader(certFile, keyFile)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		reloader.Logger = s.logger()
+		config.GetCertificate = reloader.GetCertificate
+	}
+
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		listener.Close()
+		return fmt.Errorf("TLS requires a certificate, either through certFile and keyFile or TLSConfig")
+	}
+
+	return s.Serve(tls.NewListener(listener, config))
+}
+
+// handshake completes the TLS handshake up front under the header timeout, so a client that never
+// finishes it can't hold the connection open.
+func (s *Server) handshake(cn *tls.Conn) error {
+	if s.WriteTimeout > 0 {
+		cn.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+	defer cn.SetWriteDeadline(time.Time{})
+
+	return cn.Handshake()
+}
+
+// CertReloader serves a certificate from disk and reloads it whenever the certificate or key file changes.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	// Logger reports failed reloads, which are otherwise silent since the previous certificate stays in use.
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate. When the files changed but can't be loaded,
+// for instance halfway through a rotation, the previous certificate is kept.
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if modTime, err := c.latestModTime(); err == nil && !modTime.Equal(c.modTime) {
+		if err := c.reload(); err != nil {
+			c.modTime = modTime // don't retry on every handshake, the next change to the files will
+			if c.Logger != nil {
+				c.Logger.Error("failed reloading TLS certificate, keeping the previous one",
+					"cert_file", c.certFile,
+					"key_file", c.keyFile,
+					"error", err,
+				)
+			}
+		}
+	}
+
+	return c.cert, nil
+}
+
+func (c *CertReloader) reload() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed loading TLS certificate: %w", err)
+	}
+
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+func (c *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed reading TLS file: %w", err)
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	router2 "github.com/Andreashoj/go-http-server/router"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for commonName to dir and returns the file paths.
+func writeSelfSignedCert(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed creating certificate: %s", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed marshalling key: %s", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed writing certificate: %s", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatalf("failed writing key: %s", err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestServer_ServeTLS(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t, t.TempDir(), "example.com")
+
+	s := newTestServer()
+	s.Router.Get("/tls", func(writer router2.HTTPWriter, request router2.HTTPRequest) {
+		state := request.TLS()
+		if state == nil {
+			writer.Response("plain", 200)
+			return
+		}
+		writer.Response(fmt.Sprintf("%s %s", tls.VersionName(state.Version), state.ServerName), 200)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed creating listener: %s", err)
+	}
+	go s.ServeTLS(listener, certFile, keyFile)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS13,
+	})
+	if err != nil {
+		t.Fatalf("failed dialing server: %s", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /tls HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("failed reading response: %s", err)
+	}
+
+	expected := "HTTP/1.1 200 OK\r\nContent-Length: 19\r\nConnection: close\r\n\r\nTLS 1.3 example.com"
+	if string(response) != expected {
+		t.Errorf("expected response %q but got %q", expected, response)
+	}
+}
+
+func TestServer_ServeTLSWithoutCertificate(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed creating listener: %s", err)
+	}
+
+	if err := newTestServer().ServeTLS(listener, "", ""); err == nil {
+		t.Errorf("expected ServeTLS to fail without a certificate")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "old.example.com")
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed creating reloader: %s", err)
+	}
+
+	assertCommonName := func(expected string) {
+		t.Helper()
+		cert, err := reloader.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("failed getting certificate: %s", err)
+		}
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("failed parsing certificate: %s", err)
+		}
+
+		if leaf.Subject.CommonName != expected {
+			t.Errorf("expected certificate for %s but got %s", expected, leaf.Subject.CommonName)
+		}
+	}
+	assertCommonName("old.example.com")
+
+	// Rotate the files, pushing the modification time forward so the change is seen regardless of timer resolution
+	writeSelfSignedCert(t, dir, "new.example.com")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	os.Chtimes(keyFile, future, future)
+	assertCommonName("new.example.com")
+
+	// A broken rotation keeps serving the last good certificate
+	os.WriteFile(certFile, []byte("not a certificate"), 0o600)
+	future = future.Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	assertCommonName("new.example.com")
+
+	if _, err := NewCertReloader(filepath.Join(dir, "missing.pem"), keyFile); err == nil {
+		t.Errorf("expected NewCertReloader to fail on a missing certificate")
+	}
+}